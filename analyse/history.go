@@ -0,0 +1,87 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package analyse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ParseHistory converts the JSON recorded values of a param, as served
+// by /params/<name>?history, into events.
+func ParseHistory(r io.Reader, name string) ([]*Event, error) {
+	var samples []struct {
+		Time  time.Time
+		Value interface{}
+	}
+	if err := json.NewDecoder(r).Decode(&samples); err != nil {
+		return nil, fmt.Errorf("%v: %v", name, err)
+	}
+
+	var events []*Event
+	for _, s := range samples {
+		e := &Event{
+			Time:   s.Time,
+			Name:   name,
+			Type:   "json",
+			Values: make(map[string]float64),
+		}
+		if text, ok := s.Value.(string); ok {
+			e.Type = "string"
+			e.Text = text
+		} else {
+			jsonValues("", s.Value, e.Values)
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// jsonValues converts a decoded JSON value into its numeric leaves.
+func jsonValues(prefix string, v interface{}, values map[string]float64) {
+	switch v := v.(type) {
+	case float64:
+		values[prefix] = v
+	case bool:
+		if v {
+			values[prefix] = 1
+		} else {
+			values[prefix] = 0
+		}
+	case map[string]interface{}:
+		for key, child := range v {
+			name := strings.ToLower(key)
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+			jsonValues(name, child, values)
+		}
+	}
+}
+
+// Merge combines event lists and sorts them by time.
+func Merge(lists ...[]*Event) []*Event {
+	var all []*Event
+	for _, events := range lists {
+		all = append(all, events...)
+	}
+	sort.Stable(byTime(all))
+	return all
+}
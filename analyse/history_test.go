@@ -0,0 +1,49 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package analyse
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHistory(t *testing.T) {
+	fix, err := ParseHistory(strings.NewReader(`[
+{"Time": "2017-06-01T10:00:01Z", "Value": 3},
+{"Time": "2017-06-01T10:00:03Z", "Value": 4}
+]`), "gps.fix")
+	assert.Nil(t, err)
+	assert.Equal(t, len(fix), 2)
+	assert.Equal(t, fix[1].Values[""], 4.0)
+
+	offset, err := ParseHistory(strings.NewReader(`[
+{"Time": "2017-06-01T10:00:02Z", "Value": {"Yaw": 1.5, "Inner": {"Ok": true}}}
+]`), "pantilt.offset")
+	assert.Nil(t, err)
+	assert.Equal(t, offset[0].Values["yaw"], 1.5)
+	assert.Equal(t, offset[0].Values["inner.ok"], 1.0)
+
+	all := Merge(fix, offset)
+	assert.Equal(t, all[1].Name, "pantilt.offset")
+
+	series := Collect(all)
+	assert.Equal(t, series["gps.fix"].Times, []float64{0, 2})
+
+	_, err = ParseHistory(strings.NewReader("nope"), "gps.fix")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,252 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package analyse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// Parquet physical types, converted types, and enums used below.
+// See https://github.com/apache/parquet-format.
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+
+	parquetRequired     = 0
+	parquetPlain        = 0
+	parquetRLE          = 3
+	parquetUncompressed = 0
+	parquetDataPage     = 0
+)
+
+// Thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// compact writes the Thrift compact protocol used by the Parquet
+// metadata.
+type compact struct {
+	buf bytes.Buffer
+	// last holds the last field ID of each open struct.
+	last []int16
+}
+
+func newCompact() *compact {
+	return &compact{last: []int16{0}}
+}
+
+func (c *compact) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	c.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (c *compact) zigzag(v int64) {
+	c.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (c *compact) field(id int16, typ byte) {
+	last := &c.last[len(c.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		c.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		c.buf.WriteByte(typ)
+		c.zigzag(int64(id))
+	}
+	*last = id
+}
+
+func (c *compact) i32(id int16, v int) {
+	c.field(id, thriftI32)
+	c.zigzag(int64(v))
+}
+
+func (c *compact) i64(id int16, v int64) {
+	c.field(id, thriftI64)
+	c.zigzag(v)
+}
+
+func (c *compact) binary(v string) {
+	c.varint(uint64(len(v)))
+	c.buf.WriteString(v)
+}
+
+func (c *compact) str(id int16, v string) {
+	c.field(id, thriftBinary)
+	c.binary(v)
+}
+
+func (c *compact) list(id int16, typ byte, size int) {
+	c.field(id, thriftList)
+	if size < 15 {
+		c.buf.WriteByte(byte(size)<<4 | typ)
+	} else {
+		c.buf.WriteByte(0xf0 | typ)
+		c.varint(uint64(size))
+	}
+}
+
+// begin starts a struct, either as field id or, if id is zero, as a
+// list element.
+func (c *compact) begin(id int16) {
+	if id != 0 {
+		c.field(id, thriftStruct)
+	}
+	c.last = append(c.last, 0)
+}
+
+func (c *compact) end() {
+	c.buf.WriteByte(0)
+	c.last = c.last[:len(c.last)-1]
+}
+
+// column is one required, plain encoded Parquet column.
+type column struct {
+	name      string
+	typ       int
+	converted int
+	data      bytes.Buffer
+}
+
+func (col *column) int64(v int64) {
+	binary.Write(&col.data, binary.LittleEndian, v)
+}
+
+func (col *column) double(v float64) {
+	binary.Write(&col.data, binary.LittleEndian, math.Float64bits(v))
+}
+
+func (col *column) byteArray(v string) {
+	binary.Write(&col.data, binary.LittleEndian, uint32(len(v)))
+	col.data.WriteString(v)
+}
+
+// pageHeader returns the header of a data page holding rows values.
+func pageHeader(size, rows int) []byte {
+	c := newCompact()
+	c.i32(1, parquetDataPage)
+	c.i32(2, size)
+	c.i32(3, size)
+	c.begin(5)
+	c.i32(1, rows)
+	c.i32(2, parquetPlain)
+	c.i32(3, parquetRLE)
+	c.i32(4, parquetRLE)
+	c.end()
+	c.end()
+	return c.buf.Bytes()
+}
+
+// WriteParquet writes all series in long form, with the same columns
+// as WriteCSV, as an uncompressed Parquet file with one row group.
+func WriteParquet(w io.Writer, start time.Time, all map[string]*Series) error {
+	columns := []*column{
+		{name: "time", typ: parquetInt64, converted: parquetTimestampMicros},
+		{name: "seconds", typ: parquetDouble, converted: -1},
+		{name: "name", typ: parquetByteArray, converted: parquetUTF8},
+		{name: "value", typ: parquetDouble, converted: -1},
+	}
+	rows := 0
+	for _, name := range Names(all) {
+		s := all[name]
+		for i, at := range s.Times {
+			columns[0].int64(stamp(start, at).UnixNano() / int64(time.Microsecond))
+			columns[1].double(at)
+			columns[2].byteArray(name)
+			columns[3].double(s.Values[i])
+			rows++
+		}
+	}
+
+	var file bytes.Buffer
+	file.WriteString("PAR1")
+
+	offsets := make([]int64, len(columns))
+	sizes := make([]int64, len(columns))
+	total := int64(0)
+	for i, col := range columns {
+		offsets[i] = int64(file.Len())
+		file.Write(pageHeader(col.data.Len(), rows))
+		file.Write(col.data.Bytes())
+		sizes[i] = int64(file.Len()) - offsets[i]
+		total += sizes[i]
+	}
+
+	// FileMetaData.
+	c := newCompact()
+	c.i32(1, 1)
+	c.list(2, thriftStruct, len(columns)+1)
+	c.begin(0)
+	c.str(4, "schema")
+	c.i32(5, len(columns))
+	c.end()
+	for _, col := range columns {
+		c.begin(0)
+		c.i32(1, col.typ)
+		c.i32(3, parquetRequired)
+		c.str(4, col.name)
+		if col.converted >= 0 {
+			c.i32(6, col.converted)
+		}
+		c.end()
+	}
+	c.i64(3, int64(rows))
+	c.list(4, thriftStruct, 1)
+	c.begin(0)
+	c.list(1, thriftStruct, len(columns))
+	for i, col := range columns {
+		c.begin(0)
+		c.i64(2, offsets[i])
+		c.begin(3)
+		c.i32(1, col.typ)
+		c.list(2, thriftI32, 2)
+		c.zigzag(parquetPlain)
+		c.zigzag(parquetRLE)
+		c.list(3, thriftBinary, 1)
+		c.binary(col.name)
+		c.i32(4, parquetUncompressed)
+		c.i64(5, int64(rows))
+		c.i64(6, sizes[i])
+		c.i64(7, sizes[i])
+		c.i64(9, offsets[i])
+		c.end()
+		c.end()
+	}
+	c.i64(2, total)
+	c.i64(3, int64(rows))
+	c.end()
+	c.str(6, "pipoint")
+	c.end()
+
+	file.Write(c.buf.Bytes())
+	binary.Write(&file, binary.LittleEndian, uint32(c.buf.Len()))
+	file.WriteString("PAR1")
+
+	_, err := w.Write(file.Bytes())
+	return err
+}
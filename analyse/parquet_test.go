@@ -0,0 +1,134 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package analyse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// thriftReader decodes the Thrift compact protocol into maps of field
+// ID to value.
+type thriftReader struct {
+	r *bytes.Reader
+}
+
+func (t *thriftReader) zigzag() int64 {
+	v, _ := binary.ReadUvarint(t.r)
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (t *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case thriftI32, thriftI64:
+		return t.zigzag()
+	case thriftBinary:
+		n, _ := binary.ReadUvarint(t.r)
+		b := make([]byte, n)
+		t.r.Read(b)
+		return string(b)
+	case thriftList:
+		header, _ := t.r.ReadByte()
+		size := uint64(header >> 4)
+		if size == 15 {
+			size, _ = binary.ReadUvarint(t.r)
+		}
+		var list []interface{}
+		for i := uint64(0); i < size; i++ {
+			list = append(list, t.value(header&0xf))
+		}
+		return list
+	case thriftStruct:
+		fields := make(map[int16]interface{})
+		last := int16(0)
+		for {
+			header, _ := t.r.ReadByte()
+			if header == 0 {
+				return fields
+			}
+			if delta := int16(header >> 4); delta != 0 {
+				last += delta
+			} else {
+				last = int16(t.zigzag())
+			}
+			fields[last] = t.value(header & 0xf)
+		}
+	}
+	panic("Unhandled type")
+}
+
+func thriftStructAt(b []byte) map[int16]interface{} {
+	t := &thriftReader{bytes.NewReader(b)}
+	return t.value(thriftStruct).(map[int16]interface{})
+}
+
+func TestWriteParquet(t *testing.T) {
+	events, _ := Parse(strings.NewReader(session))
+	all := Collect(events)
+	start := events[0].Time
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteParquet(&buf, start, all))
+	b := buf.Bytes()
+	assert.Equal(t, "PAR1", string(b[:4]))
+	assert.Equal(t, "PAR1", string(b[len(b)-4:]))
+
+	size := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	meta := thriftStructAt(b[len(b)-8-size : len(b)-8])
+
+	rows := 0
+	for _, s := range all {
+		rows += len(s.Times)
+	}
+	assert.Equal(t, int64(rows), meta[3])
+
+	var names []string
+	for _, e := range meta[2].([]interface{})[1:] {
+		names = append(names, e.(map[int16]interface{})[4].(string))
+	}
+	assert.Equal(t, []string{"time", "seconds", "name", "value"}, names)
+
+	group := meta[4].([]interface{})[0].(map[int16]interface{})
+	chunks := group[1].([]interface{})
+	assert.Equal(t, 4, len(chunks))
+
+	// The rows are sorted by name then time, so the first value
+	// is the first gps.alt.
+	chunk := chunks[3].(map[int16]interface{})[3].(map[int16]interface{})
+	assert.Equal(t, []interface{}{"value"}, chunk[3])
+	offset := chunk[9].(int64)
+	r := &thriftReader{bytes.NewReader(b[offset:])}
+	page := r.value(thriftStruct).(map[int16]interface{})
+	assert.Equal(t, int64(rows), page[5].(map[int16]interface{})[1])
+	assert.Equal(t, int64(rows*8), page[2])
+
+	data := b[len(b)-r.r.Len():]
+	assert.Equal(t, 0.0, math.Float64frombits(binary.LittleEndian.Uint64(data)))
+
+	// The time column holds microseconds since the epoch.  The first
+	// gps is at the start of the log.
+	chunk = chunks[0].(map[int16]interface{})[3].(map[int16]interface{})
+	r = &thriftReader{bytes.NewReader(b[chunk[9].(int64):])}
+	r.value(thriftStruct)
+	data = b[len(b)-r.r.Len():]
+	micros := int64(binary.LittleEndian.Uint64(data))
+	assert.Equal(t, start.UnixNano(), micros*1000)
+}
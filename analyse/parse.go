@@ -0,0 +1,217 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package analyse reads event logs and summarises a session.
+package analyse
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	stampFormat = "2006/01/02 15:04:05.000000"
+)
+
+var lineRe = regexp.MustCompile(`^(\d+/\d+/\d+ \d+:\d+:[\d.]+) (\S+): (\S+) (\S+) (.*)$`)
+
+// Event is one param update or message from the event log.
+type Event struct {
+	Time time.Time
+	File string
+	Name string
+	Type string
+	Raw  string
+	// Values holds the numeric leaves by lower case field name.
+	// Scalars use the empty name.
+	Values map[string]float64
+	// Text holds the value of string params.
+	Text string
+}
+
+// parseNumber parses a float, integer, hex, or bool as formatted by
+// %#v.
+func parseNumber(v string) (float64, bool) {
+	switch v {
+	case "true":
+		return 1, true
+	case "false":
+		return 0, true
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f, true
+	}
+	if i, err := strconv.ParseInt(v, 0, 64); err == nil {
+		return float64(i), true
+	}
+	if u, err := strconv.ParseUint(v, 0, 64); err == nil {
+		return float64(u), true
+	}
+	return 0, false
+}
+
+// splitFields splits the body of a %#v formatted struct into
+// top level fields.
+func splitFields(body string) []string {
+	var fields []string
+	depth := 0
+	start := 0
+
+	for i, ch := range body {
+		switch ch {
+		case '{', '[', '(':
+			depth++
+		case '}', ']', ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				fields = append(fields, strings.TrimSpace(body[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if rest := strings.TrimSpace(body[start:]); rest != "" {
+		fields = append(fields, rest)
+	}
+	return fields
+}
+
+// parseValues converts a %#v formatted value into its numeric leaves.
+func parseValues(prefix string, raw string, values map[string]float64) {
+	open := strings.Index(raw, "{")
+	if open < 0 || !strings.HasSuffix(raw, "}") {
+		if f, ok := parseNumber(raw); ok {
+			values[prefix] = f
+		}
+		return
+	}
+
+	for _, field := range splitFields(raw[open+1 : len(raw)-1]) {
+		colon := strings.Index(field, ":")
+		if colon < 0 {
+			continue
+		}
+		name := strings.ToLower(field[:colon])
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		parseValues(name, field[colon+1:], values)
+	}
+}
+
+// ParseLine parses a single event log line.  Returns false if the
+// line isn't an event.
+func ParseLine(line string) (*Event, bool) {
+	m := lineRe.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+	if m == nil {
+		return nil, false
+	}
+
+	stamp, err := time.ParseInLocation(stampFormat, m[1], time.Local)
+	if err != nil {
+		return nil, false
+	}
+
+	e := &Event{
+		Time:   stamp,
+		File:   m[2],
+		Name:   m[3],
+		Type:   m[4],
+		Raw:    m[5],
+		Values: make(map[string]float64),
+	}
+
+	if e.Type == "string" {
+		if text, err := strconv.Unquote(e.Raw); err == nil {
+			e.Text = text
+		}
+	} else {
+		parseValues("", e.Raw, e.Values)
+	}
+	return e, true
+}
+
+// Parse reads all events from r.
+func Parse(r io.Reader) ([]*Event, error) {
+	var events []*Event
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		if e, ok := ParseLine(scanner.Text()); ok {
+			events = append(events, e)
+		}
+	}
+	return events, scanner.Err()
+}
+
+// ParseFile reads all events from a plain or gzipped event log.
+func ParseFile(name string) ([]*Event, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(name, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	events, err := Parse(r)
+	if err == io.ErrUnexpectedEOF {
+		// Logs from a running or crashed base aren't
+		// terminated.  Keep what was read.
+		err = nil
+	}
+	return events, err
+}
+
+// ParseFiles reads and merges the events from all files in time
+// order.
+func ParseFiles(names []string) ([]*Event, error) {
+	var events []*Event
+
+	for _, name := range names {
+		next, err := ParseFile(name)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, next...)
+	}
+
+	sort.Stable(byTime(events))
+	return events, nil
+}
+
+// byTime sorts events by time.
+type byTime []*Event
+
+func (b byTime) Len() int           { return len(b) }
+func (b byTime) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byTime) Less(i, j int) bool { return b[i].Time.Before(b[j].Time) }
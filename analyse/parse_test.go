@@ -0,0 +1,64 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package analyse
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNumber(t *testing.T) {
+	e, ok := ParseLine("2017/10/22 10:11:12.500000 pipoint.go:230: gps.fix float64 3")
+	assert.True(t, ok)
+	assert.Equal(t, e.Name, "gps.fix")
+	assert.Equal(t, e.File, "pipoint.go:230")
+	assert.Equal(t, e.Type, "float64")
+	assert.Equal(t, e.Values, map[string]float64{"": 3})
+	assert.Equal(t, e.Time.Nanosecond(), 500000000)
+}
+
+func TestParseStruct(t *testing.T) {
+	e, ok := ParseLine("2017/10/22 10:11:12.000001 pipoint.go:230: gps *pipoint.Position &pipoint.Position{Time:1.5e+09, Lat:-36.5, Lon:174.25, Alt:10, Heading:0}")
+	assert.True(t, ok)
+	assert.Equal(t, e.Values["time"], 1.5e9)
+	assert.Equal(t, e.Values["lat"], -36.5)
+	assert.Equal(t, e.Values["heading"], 0.0)
+}
+
+func TestParseMessage(t *testing.T) {
+	e, ok := ParseLine("2017/10/22 10:11:12.000001 pipoint.go:290: message *common.Heartbeat &common.Heartbeat{CUSTOM_MODE:0x10, TYPE:0x1, BASE_MODE:0x51}")
+	assert.True(t, ok)
+	assert.Equal(t, e.Values["custom_mode"], 16.0)
+	assert.Equal(t, e.Values["base_mode"], 81.0)
+}
+
+func TestParseString(t *testing.T) {
+	e, ok := ParseLine(`2017/10/22 10:11:12.000001 pipoint.go:230: build_label string "v1, beta"`)
+	assert.True(t, ok)
+	assert.Equal(t, e.Text, "v1, beta")
+	assert.Equal(t, len(e.Values), 0)
+}
+
+func TestParseSkipsOther(t *testing.T) {
+	events, err := Parse(strings.NewReader(`garbage
+2017/10/22 10:11:12.000000 pipoint.go:230: state float64 1
+2017/10/22 10:11:13.000000 pipoint.go:230: state float64 2
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, len(events), 2)
+}
@@ -0,0 +1,97 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package analyse
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+)
+
+const (
+	plotWidth  = 800
+	plotHeight = 200
+	plotMargin = 40
+)
+
+var plotColours = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728"}
+
+// bounds returns the range of the given values, padded so that flat
+// lines are visible.
+func bounds(lines []*Series, get func(s *Series) []float64) (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range lines {
+		for _, v := range get(s) {
+			lo = math.Min(lo, v)
+			hi = math.Max(hi, v)
+		}
+	}
+	if math.IsInf(lo, 0) {
+		return 0, 1
+	}
+	if hi-lo < 1e-9 {
+		return lo - 0.5, hi + 0.5
+	}
+	return lo, hi
+}
+
+// Plot renders one or more series as a SVG line chart.
+func Plot(title string, lines ...*Series) []byte {
+	var buf bytes.Buffer
+
+	x0, x1 := bounds(lines, func(s *Series) []float64 { return s.Times })
+	y0, y1 := bounds(lines, func(s *Series) []float64 { return s.Values })
+
+	w := float64(plotWidth - 2*plotMargin)
+	h := float64(plotHeight - 2*plotMargin)
+	sx := func(x float64) float64 { return plotMargin + (x-x0)/(x1-x0)*w }
+	sy := func(y float64) float64 { return plotMargin + h - (y-y0)/(y1-y0)*h }
+
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`+"\n",
+		plotWidth, plotHeight)
+	fmt.Fprintf(&buf, `<text x="%d" y="%d" font-size="13">%s</text>`+"\n",
+		plotMargin, plotMargin/2, html.EscapeString(title))
+	fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="%g" height="%g" fill="none" stroke="#888"/>`+"\n",
+		plotMargin, plotMargin, w, h)
+
+	// Axis labels.
+	fmt.Fprintf(&buf, `<text x="%d" y="%g" text-anchor="end">%.4g</text>`+"\n",
+		plotMargin-4, sy(y1)+4, y1)
+	fmt.Fprintf(&buf, `<text x="%d" y="%g" text-anchor="end">%.4g</text>`+"\n",
+		plotMargin-4, sy(y0), y0)
+	fmt.Fprintf(&buf, `<text x="%g" y="%g">%.1f s</text>`+"\n",
+		sx(x0), sy(y0)+14, x0)
+	fmt.Fprintf(&buf, `<text x="%g" y="%g" text-anchor="end">%.1f s</text>`+"\n",
+		sx(x1), sy(y0)+14, x1)
+
+	for i, s := range lines {
+		colour := plotColours[i%len(plotColours)]
+
+		fmt.Fprintf(&buf, `<polyline fill="none" stroke="%s" points="`, colour)
+		for j, x := range s.Times {
+			fmt.Fprintf(&buf, "%.1f,%.1f ", sx(x), sy(s.Values[j]))
+		}
+		buf.WriteString("\"/>\n")
+
+		fmt.Fprintf(&buf, `<text x="%g" y="%d" fill="%s" text-anchor="end">%s</text>`+"\n",
+			float64(plotWidth-plotMargin), plotMargin/2+i*12, colour,
+			html.EscapeString(s.Name))
+	}
+
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
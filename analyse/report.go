@@ -0,0 +1,80 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package analyse
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+)
+
+// plotGroups are the series that are shown together in the report.
+var plotGroups = []struct {
+	Title string
+	Names []string
+}{
+	{"State", []string{"state"}},
+	{"Link", []string{"link.status"}},
+	{"GPS fix", []string{"gps.fix"}},
+	{"Altitude (m)", []string{"gps.alt"}},
+	{"Speed (m/s)", []string{"gps.vog"}},
+	{"Pan (rad)", []string{"pantilt.pan.sp"}},
+	{"Pan (ms)", []string{"pantilt.pan.pv"}},
+	{"Tilt (rad)", []string{"pantilt.tilt.sp"}},
+	{"Tilt (ms)", []string{"pantilt.tilt.pv"}},
+	{"Event log (bytes)", []string{"elog.written", "elog.dropped"}},
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>pipoint session {{.Start}}</title>
+<style>body { font-family: sans-serif; }</style>
+</head>
+<body>
+<h1>pipoint session {{.Start}}</h1>
+<pre>{{.Summary}}</pre>
+{{range .Plots}}<div>{{.}}</div>
+{{end}}</body>
+</html>
+`))
+
+// WriteReport writes a HTML report with the summary and plots of the
+// interesting series.
+func WriteReport(w io.Writer, summary *Summary, all map[string]*Series) error {
+	var text bytes.Buffer
+	summary.Write(&text)
+
+	var plots []template.HTML
+	for _, group := range plotGroups {
+		var lines []*Series
+		for _, name := range group.Names {
+			if s, ok := all[name]; ok {
+				lines = append(lines, s)
+			}
+		}
+		if len(lines) != 0 {
+			plots = append(plots, template.HTML(Plot(group.Title, lines...)))
+		}
+	}
+
+	return reportTemplate.Execute(w, map[string]interface{}{
+		"Start":   summary.Start.Format("2006-01-02 15:04:05"),
+		"Summary": text.String(),
+		"Plots":   plots,
+	})
+}
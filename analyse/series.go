@@ -0,0 +1,116 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package analyse
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Series is the values of one param leaf over time.
+type Series struct {
+	Name string
+	// Times is the seconds since the start of the log.
+	Times  []float64
+	Values []float64
+}
+
+// Collect splits the events into one series per numeric leaf,
+// such as gps.lat.  Messages are skipped.
+func Collect(events []*Event) map[string]*Series {
+	all := make(map[string]*Series)
+	if len(events) == 0 {
+		return all
+	}
+	start := events[0].Time
+
+	for _, e := range events {
+		if e.Name == "message" {
+			continue
+		}
+		at := e.Time.Sub(start).Seconds()
+
+		for leaf, v := range e.Values {
+			name := e.Name
+			if leaf != "" {
+				name += "." + leaf
+			}
+			s, ok := all[name]
+			if !ok {
+				s = &Series{Name: name}
+				all[name] = s
+			}
+			s.Times = append(s.Times, at)
+			s.Values = append(s.Values, v)
+		}
+	}
+	return all
+}
+
+// Names returns the series names in sorted order.
+func Names(all map[string]*Series) []string {
+	var names []string
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stamp returns the wall time of a series sample.
+func stamp(start time.Time, at float64) time.Time {
+	return start.Add(time.Duration(at * float64(time.Second)))
+}
+
+// WriteCSV writes all series in long form as time, name, value
+// rows.
+func WriteCSV(w io.Writer, start time.Time, all map[string]*Series) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"time", "seconds", "name", "value"})
+
+	for _, name := range Names(all) {
+		s := all[name]
+		for i, at := range s.Times {
+			out.Write([]string{
+				stamp(start, at).Format(time.RFC3339Nano),
+				strconv.FormatFloat(at, 'f', 6, 64),
+				name,
+				strconv.FormatFloat(s.Values[i], 'g', -1, 64),
+			})
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// WriteSeriesCSV writes one series as time, value rows.
+func WriteSeriesCSV(w io.Writer, start time.Time, s *Series) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"time", "seconds", s.Name})
+
+	for i, at := range s.Times {
+		out.Write([]string{
+			stamp(start, at).Format(time.RFC3339Nano),
+			strconv.FormatFloat(at, 'f', 6, 64),
+			strconv.FormatFloat(s.Values[i], 'g', -1, 64),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,197 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package analyse
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+const (
+	// linkTimeout matches the validity window of a Param.
+	linkTimeout = 3.0
+)
+
+var servos = []string{"pantilt.pan", "pantilt.tilt"}
+
+// Gap is a period with no link to the rover.
+type Gap struct {
+	// Start is the seconds since the start of the log.
+	Start    float64
+	Duration float64
+}
+
+// Summary holds the overall statistics for a session.
+type Summary struct {
+	Start    time.Time
+	Duration float64
+	Events   int
+
+	GPSCount int
+	// GPSRate is the mean GPS update rate in Hz.
+	GPSRate float64
+
+	LinkGaps []Gap
+
+	// States is the seconds spent in each state.
+	States map[int]float64
+	// Saturated is the seconds each servo spent at its limit.
+	Saturated map[string]float64
+}
+
+// LinkDown returns the total seconds without a link.
+func (s *Summary) LinkDown() float64 {
+	total := 0.0
+	for _, gap := range s.LinkGaps {
+		total += gap.Duration
+	}
+	return total
+}
+
+// Summarise calculates the statistics for a set of events.
+func Summarise(events []*Event) *Summary {
+	s := &Summary{
+		Events:    len(events),
+		States:    make(map[int]float64),
+		Saturated: make(map[string]float64),
+	}
+	if len(events) == 0 {
+		return s
+	}
+
+	s.Start = events[0].Time
+	s.Duration = events[len(events)-1].Time.Sub(s.Start).Seconds()
+
+	all := Collect(events)
+
+	s.gps(all)
+	s.link(all)
+	s.states(all)
+	for _, name := range servos {
+		s.saturation(all, name)
+	}
+	return s
+}
+
+func (s *Summary) gps(all map[string]*Series) {
+	gps, ok := all["gps.time"]
+	if !ok {
+		return
+	}
+	s.GPSCount = len(gps.Times)
+	if s.GPSCount < 2 {
+		return
+	}
+	span := gps.Times[len(gps.Times)-1] - gps.Times[0]
+	if span > 0 {
+		s.GPSRate = float64(s.GPSCount-1) / span
+	}
+}
+
+func (s *Summary) link(all map[string]*Series) {
+	beats, ok := all["rover.heartbeats"]
+	if !ok {
+		// Older logs called the count heartbeat.
+		if beats, ok = all["heartbeat"]; !ok {
+			return
+		}
+	}
+
+	last := 0.0
+	for i := 0; i <= len(beats.Times); i++ {
+		at := s.Duration
+		if i < len(beats.Times) {
+			at = beats.Times[i]
+		}
+		if at-last >= linkTimeout {
+			s.LinkGaps = append(s.LinkGaps, Gap{last, at - last})
+		}
+		last = at
+	}
+}
+
+// hold calls fn with each value and how long it was held for.
+func (s *Summary) hold(series *Series, fn func(v, held float64)) {
+	for i, at := range series.Times {
+		until := s.Duration
+		if i+1 < len(series.Times) {
+			until = series.Times[i+1]
+		}
+		fn(series.Values[i], until-at)
+	}
+}
+
+func (s *Summary) states(all map[string]*Series) {
+	state, ok := all["state"]
+	if !ok {
+		return
+	}
+	s.hold(state, func(v, held float64) {
+		s.States[int(v)] += held
+	})
+}
+
+func (s *Summary) saturation(all map[string]*Series, name string) {
+	pv, ok := all[name+".pv"]
+	if !ok {
+		return
+	}
+
+	// Defaults from NewServo.
+	min, max := 1.0, 2.0
+	if v, ok := all[name+".min"]; ok {
+		min = v.Values[len(v.Values)-1]
+	}
+	if v, ok := all[name+".max"]; ok {
+		max = v.Values[len(v.Values)-1]
+	}
+
+	const epsilon = 1e-6
+	s.hold(pv, func(v, held float64) {
+		if v <= min+epsilon || v >= max-epsilon {
+			s.Saturated[name] += held
+		}
+	})
+}
+
+// Write prints the summary in human readable form.
+func (s *Summary) Write(w io.Writer) {
+	fmt.Fprintf(w, "Start:       %v\n", s.Start.Format(time.RFC3339))
+	fmt.Fprintf(w, "Duration:    %.1f s\n", s.Duration)
+	fmt.Fprintf(w, "Events:      %d\n", s.Events)
+	fmt.Fprintf(w, "GPS:         %d updates, %.2f Hz\n", s.GPSCount, s.GPSRate)
+	fmt.Fprintf(w, "Link gaps:   %d, %.1f s total\n", len(s.LinkGaps), s.LinkDown())
+	for _, gap := range s.LinkGaps {
+		fmt.Fprintf(w, "  at %.1f s for %.1f s\n", gap.Start, gap.Duration)
+	}
+
+	var states []int
+	for state := range s.States {
+		states = append(states, state)
+	}
+	sort.Ints(states)
+	for _, state := range states {
+		fmt.Fprintf(w, "State %d:     %.1f s\n", state, s.States[state])
+	}
+
+	for _, name := range servos {
+		if held, ok := s.Saturated[name]; ok {
+			fmt.Fprintf(w, "Saturated:   %s %.1f s\n", name, held)
+		}
+	}
+}
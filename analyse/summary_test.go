@@ -0,0 +1,76 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package analyse
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const session = `2017/10/22 10:00:00.000000 pipoint.go:230: state float64 0
+2017/10/22 10:00:00.000000 pipoint.go:230: pantilt.pan *pipoint.ServoParams &pipoint.ServoParams{Pin:0, Span:3.14, Min:0.5, Max:2.5, Low:0.6, High:2.4, Tau:0.5}
+2017/10/22 10:00:00.000000 pipoint.go:230: heartbeat float64 1
+2017/10/22 10:00:00.000000 pipoint.go:230: gps *pipoint.Position &pipoint.Position{Time:1, Lat:0, Lon:0, Alt:0, Heading:0}
+2017/10/22 10:00:01.000000 pipoint.go:230: heartbeat float64 2
+2017/10/22 10:00:01.000000 pipoint.go:230: gps *pipoint.Position &pipoint.Position{Time:2, Lat:0, Lon:0, Alt:0, Heading:0}
+2017/10/22 10:00:02.000000 pipoint.go:230: gps *pipoint.Position &pipoint.Position{Time:3, Lat:0, Lon:0, Alt:0, Heading:0}
+2017/10/22 10:00:02.000000 pipoint.go:230: pantilt.pan.pv float64 2.5
+2017/10/22 10:00:04.000000 pipoint.go:230: state float64 2
+2017/10/22 10:00:06.000000 pipoint.go:230: pantilt.pan.pv float64 1.5
+2017/10/22 10:00:06.000000 pipoint.go:230: heartbeat float64 3
+2017/10/22 10:00:10.000000 pipoint.go:230: heartbeat float64 4
+`
+
+func TestSummarise(t *testing.T) {
+	events, err := Parse(strings.NewReader(session))
+	assert.Nil(t, err)
+
+	s := Summarise(events)
+	assert.Equal(t, s.Duration, 10.0)
+	assert.Equal(t, s.GPSCount, 3)
+	assert.InDelta(t, s.GPSRate, 1.0, 0.001)
+
+	// Gaps of 5 s and 4 s.
+	assert.Equal(t, s.LinkGaps, []Gap{{1, 5}, {6, 4}})
+	assert.Equal(t, s.LinkDown(), 9.0)
+
+	assert.Equal(t, s.States, map[int]float64{0: 4, 2: 6})
+	// At the max of 2.5 from 2 s to 6 s.
+	assert.Equal(t, s.Saturated["pantilt.pan"], 4.0)
+}
+
+func TestReport(t *testing.T) {
+	events, _ := Parse(strings.NewReader(session))
+	all := Collect(events)
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteReport(&buf, Summarise(events), all))
+	assert.Contains(t, buf.String(), "<svg")
+	assert.Contains(t, buf.String(), "pantilt.pan.pv")
+
+	buf.Reset()
+	assert.Nil(t, WriteCSV(&buf, events[0].Time, all))
+	assert.Contains(t, buf.String(), "4.000000,state,2\n")
+
+	buf.Reset()
+	assert.Nil(t, WriteSeriesCSV(&buf, events[0].Time, all["state"]))
+	assert.True(t, strings.HasPrefix(buf.String(), "time,seconds,state\n"))
+	assert.Contains(t, buf.String(), ",4.000000,2\n")
+	assert.Equal(t, 3, strings.Count(buf.String(), "\n"))
+}
@@ -0,0 +1,507 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"juju.nz/x/pipoint/param"
+	"juju.nz/x/pipoint/util"
+)
+
+// AnnounceRule says something when a param or leaf changes.
+type AnnounceRule struct {
+	// Param is the param or leaf to watch, such as "gps.fix" or
+	// "rover.position.up".
+	Param string
+	// When is one of:
+	//   update: every update
+	//   change: when the value changes
+	//   equals: when the value becomes Value
+	//   above: when the value rises to Value or above
+	//   below: when the value falls below Value
+	//   crosses: when the value goes above or below Value
+	//   valid: when the param becomes valid
+	//   stale: when the param goes stale
+	When  string
+	Value float64
+	// Min and Max limit when the rule applies if Max is greater
+	// than Min.
+	Min float64
+	Max float64
+	// Say is a text/template executed with an announceData.  An
+	// empty Say disables the rule.
+	Say string
+	// Priority is info, state, or safety.
+	Priority string
+	// Limit is the minimum time between announcements, such as
+	// "5s" or 5.
+	Limit string
+	// States are the states the rule applies in.  Empty means all.
+	States []string
+}
+
+// announceData is passed to the Say template.
+type announceData struct {
+	// Name is the name of the param or leaf.
+	Name string
+	// Value is the current value.
+	Value interface{}
+	// Text is the enum name of the value if the param has one,
+	// otherwise the value formatted as text.
+	Text string
+}
+
+// defaultAnnounceRules are the built in announcements.  Rules in the
+// announce section of the config replace the rule with the same name.
+var defaultAnnounceRules = map[string]*AnnounceRule{
+	"state": {
+		Param:    "state",
+		When:     "update",
+		Say:      "{{.Text}}",
+		Priority: "state",
+	},
+	"online": {
+		Param:    "link.status",
+		When:     "equals",
+		Value:    1,
+		Say:      "Rover ready",
+		Priority: "safety",
+	},
+	"offline": {
+		Param:    "link.status",
+		When:     "equals",
+		Value:    2,
+		Say:      "Rover offline",
+		Priority: "safety",
+	},
+	"gps": {
+		Param:    "gps.fix",
+		When:     "above",
+		Value:    3,
+		Say:      "GPS ready",
+		Priority: "state",
+	},
+	"battery": {
+		Param:    "rover.battery.remaining",
+		When:     "below",
+		Value:    20,
+		Say:      "Battery {{.Value}} percent",
+		Priority: "safety",
+	},
+	"failed": {
+		Param:    "rover.failed",
+		When:     "change",
+		Say:      "{{if .Value}}{{.Value}} failed{{end}}",
+		Priority: "safety",
+	},
+	"speed": {
+		Param:    "gps.vog",
+		When:     "update",
+		Min:      2 / 3.6,
+		Max:      1000,
+		Say:      `{{printf "%.0f" (kph .Value)}} kph`,
+		Priority: "info",
+		Limit:    "5s",
+		States:   []string{"Run"},
+	},
+}
+
+// announceFuncs are the functions available to Say templates.  param
+// is added by the Announcer.
+var announceFuncs = template.FuncMap{
+	"kph": func(v interface{}) float64 {
+		f, _ := toFloat(v)
+		return f * 3.6
+	},
+	"round": func(v interface{}, step float64) float64 {
+		f, _ := toFloat(v)
+		if step <= 0 {
+			return f
+		}
+		return math.Floor(f/step+0.5) * step
+	},
+}
+
+var priorities = map[string]Priority{
+	"":       PriorityInfo,
+	"info":   PriorityInfo,
+	"state":  PriorityState,
+	"safety": PrioritySafety,
+}
+
+// rule is a parsed AnnounceRule and the last value seen.
+type rule struct {
+	*AnnounceRule
+	name     string
+	say      *template.Template
+	priority Priority
+	limit    float64
+
+	seen bool
+	last interface{}
+}
+
+// Announcer says things when params change according to a set of
+// rules.
+type Announcer struct {
+	mu      sync.Mutex
+	params  *param.Params
+	audio   *AudioOut
+	rules   []*rule
+	limiter *util.Limiter
+	// said holds the last announcement so that it is also
+	// published over MQTT.
+	said *param.Param
+}
+
+// NewAnnouncer creates a new announcer with the default rules.
+func NewAnnouncer(params *param.Params, audio *AudioOut) *Announcer {
+	a := &Announcer{params: params, audio: audio}
+	if params != nil {
+		a.said = params.NewWith("announcement", "", &param.Meta{
+			Description: "Last announcement",
+			ReadOnly:    true,
+		})
+	}
+	a.Configure(nil)
+	return a
+}
+
+// parseLimit parses a duration such as "5s" or a number of seconds.
+func parseLimit(limit string) (float64, error) {
+	if limit == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.ParseFloat(limit, 64); err == nil {
+		return seconds, nil
+	}
+	d, err := time.ParseDuration(limit)
+	return d.Seconds(), err
+}
+
+// parseRule checks and compiles an AnnounceRule.
+func (a *Announcer) parseRule(name string, r *AnnounceRule) (*rule, error) {
+	switch r.When {
+	case "update", "change", "equals", "above", "below", "crosses", "valid", "stale":
+	default:
+		return nil, fmt.Errorf("Unrecognised when %q", r.When)
+	}
+
+	priority, ok := priorities[strings.ToLower(r.Priority)]
+	if !ok {
+		return nil, fmt.Errorf("Unrecognised priority %q", r.Priority)
+	}
+
+	limit, err := parseLimit(r.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	say, err := template.New(name).Funcs(announceFuncs).Funcs(template.FuncMap{
+		"param": a.lookup,
+	}).Parse(r.Say)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rule{
+		AnnounceRule: r,
+		name:         name,
+		say:          say,
+		priority:     priority,
+		limit:        limit,
+	}, nil
+}
+
+// Configure replaces the rules with the defaults plus the given
+// rules.  Invalid rules are skipped.  Rules that watch a param or
+// leaf that doesn't exist are kept, as the param may be added later,
+// but are also reported.
+func (a *Announcer) Configure(config map[string]*AnnounceRule) error {
+	merged := make(map[string]*AnnounceRule)
+	for name, r := range defaultAnnounceRules {
+		merged[name] = r
+	}
+	for name, r := range config {
+		merged[strings.ToLower(name)] = r
+	}
+
+	var names []string
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var rules []*rule
+	var err error
+
+	for _, name := range names {
+		if merged[name] == nil || merged[name].Say == "" {
+			continue
+		}
+		r, rerr := a.parseRule(name, merged[name])
+		if rerr != nil {
+			err = fmt.Errorf("announce.%v: %v", name, rerr)
+			continue
+		}
+		if a.params != nil && !a.resolves(r.Param) {
+			err = fmt.Errorf("announce.%v: No param or leaf %v", name, r.Param)
+		}
+		rules = append(rules, r)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rules = rules
+	a.limiter = util.NewLimiter()
+	return err
+}
+
+// toFloat returns the value as a number, and false if it isn't one.
+func toFloat(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Bool:
+		if v.Bool() {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+// leafValue returns the value of the named param or leaf within p.
+func leafValue(p *param.Param, name string) (interface{}, *param.Meta, bool) {
+	if strings.EqualFold(p.Name, name) {
+		return p.Get(), p.Meta(), true
+	}
+	if !strings.HasPrefix(strings.ToLower(name), strings.ToLower(p.Name)+".") {
+		return nil, nil, false
+	}
+
+	var value interface{}
+	found := false
+	p.Walk(func(_ *param.Param, path []string, leaf interface{}) {
+		if !found && strings.EqualFold(strings.Join(path, "."), name) {
+			value, found = leaf, true
+		}
+	})
+	return value, nil, found
+}
+
+// hasLeaf returns true if values of type t have a leaf at path.
+func hasLeaf(t reflect.Type, path []string) bool {
+	for _, name := range path {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := t.FieldByNameFunc(func(field string) bool {
+				return strings.EqualFold(field, name)
+			})
+			if !ok {
+				return false
+			}
+			t = field.Type
+		case reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+		case reflect.Interface:
+			return true
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// resolves returns true if name is a param or a leaf of one.  The
+// leaves of a param that has no value or type yet can't be checked
+// and are assumed to exist.
+func (a *Announcer) resolves(name string) bool {
+	for _, p := range a.params.All() {
+		if strings.EqualFold(p.Name, name) {
+			return true
+		}
+		prefix := strings.ToLower(p.Name) + "."
+		if !strings.HasPrefix(strings.ToLower(name), prefix) {
+			continue
+		}
+		t := reflect.TypeOf(p.Get())
+		if t == nil || hasLeaf(t, strings.Split(name[len(prefix):], ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the value of the named param or leaf, or nil.
+func (a *Announcer) lookup(name string) interface{} {
+	for _, p := range a.params.All() {
+		if value, _, ok := leafValue(p, name); ok {
+			return value
+		}
+	}
+	return nil
+}
+
+// inState returns true if the rule applies in the given state.
+func (r *rule) inState(state string) bool {
+	if len(r.States) == 0 {
+		return true
+	}
+	for _, s := range r.States {
+		if strings.EqualFold(s, state) {
+			return true
+		}
+	}
+	return false
+}
+
+// triggered returns true if the change from the last value to value
+// fires the rule.
+func (r *rule) triggered(value interface{}) bool {
+	last, seen := r.last, r.seen
+	r.last, r.seen = value, true
+
+	f, isNumber := toFloat(value)
+	if isNumber && r.Max > r.Min && (f < r.Min || f > r.Max) {
+		return false
+	}
+	prev, wasNumber := toFloat(last)
+	wasNumber = wasNumber && seen
+
+	switch r.When {
+	case "update":
+		return true
+	case "change":
+		return !seen || !reflect.DeepEqual(last, value)
+	case "equals":
+		return isNumber && f == r.Value && (!wasNumber || prev != r.Value)
+	case "above":
+		return isNumber && f >= r.Value && (!wasNumber || prev < r.Value)
+	case "below":
+		return isNumber && f < r.Value && (!wasNumber || prev >= r.Value)
+	case "crosses":
+		return isNumber && wasNumber && (f >= r.Value) != (prev >= r.Value)
+	default:
+		return false
+	}
+}
+
+// text executes the Say template.
+func (r *rule) text(name string, value interface{}, meta *param.Meta) (string, error) {
+	data := &announceData{Name: name, Value: value, Text: fmt.Sprint(value)}
+	if f, ok := toFloat(value); ok && meta != nil && len(meta.Enum) != 0 {
+		if i := int(f); float64(i) == f && i >= 0 && i < len(meta.Enum) {
+			data.Text = meta.Enum[i]
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := r.say.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// say announces the rule if it isn't rate limited.
+func (a *Announcer) say(r *rule, name string, value interface{}, meta *param.Meta) {
+	if r.limit > 0 && !a.limiter.Ok(r.name, r.limit) {
+		return
+	}
+	text, err := r.text(name, value, meta)
+	if err != nil {
+		log.Printf("announce.%v: %v\n", r.name, err)
+		return
+	}
+	if text == "" {
+		return
+	}
+	a.audio.Say(r.priority, text)
+	if a.said != nil {
+		a.said.Set(text)
+	}
+}
+
+// Update checks the rules against an updated param.
+func (a *Announcer) Update(p *param.Param, state string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, r := range a.rules {
+		if r.When == "valid" || r.When == "stale" {
+			continue
+		}
+		value, meta, ok := leafValue(p, r.Param)
+		if !ok {
+			continue
+		}
+		if r.triggered(value) && r.inState(state) {
+			a.say(r, r.Param, value, meta)
+		}
+	}
+}
+
+// Validity checks the rules against a param that became valid or
+// went stale.
+func (a *Announcer) Validity(p *param.Param, ok bool, state string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	when := "stale"
+	if ok {
+		when = "valid"
+	}
+	for _, r := range a.rules {
+		if r.When == when && strings.EqualFold(r.Param, p.Name) && r.inState(state) {
+			a.say(r, r.Param, p.Get(), p.Meta())
+		}
+	}
+}
+
+// Phrases returns the text of the rules that don't depend on a
+// value.
+func (a *Announcer) Phrases() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var phrases []string
+	for _, r := range a.rules {
+		if !strings.Contains(r.Say, "{{") {
+			phrases = append(phrases, r.Say)
+		}
+	}
+	return phrases
+}
@@ -0,0 +1,152 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"juju.nz/x/pipoint/param"
+)
+
+func newTestAnnouncer() (*Announcer, *AudioOut, *param.Params) {
+	ps := param.NewParams("test")
+	audio := newAudioOut(NullBackend{})
+	return NewAnnouncer(ps, audio), audio, ps
+}
+
+func TestAnnounceDefaults(t *testing.T) {
+	a, audio, ps := newTestAnnouncer()
+
+	state := ps.NewNum("state", &param.Meta{Enum: stateNames()})
+	link := ps.NewNum("link.status")
+	fix := ps.NewNum("gps.fix")
+
+	state.SetInt(2)
+	a.Update(state, "Run")
+	assert.Equal(t, []string{"Run"}, drain(audio))
+
+	// Only said when the link changes.
+	for _, status := range []int{1, 1, 2, 2, 1} {
+		link.SetInt(status)
+		a.Update(link, "Run")
+	}
+	assert.Equal(t, []string{"Rover ready", "Rover offline"}, drain(audio))
+
+	// Only said when the fix first becomes good enough.
+	for _, status := range []int{0, 3, 4, 3, 1, 3} {
+		fix.SetInt(status)
+		a.Update(fix, "Run")
+	}
+	assert.Equal(t, []string{"GPS ready"}, drain(audio))
+}
+
+func TestAnnounceValidity(t *testing.T) {
+	a, audio, ps := newTestAnnouncer()
+	rover := ps.New("rover.position")
+
+	// Not announced by default.
+	a.Validity(rover, false, "Run")
+	assert.Nil(t, drain(audio))
+
+	a.Configure(map[string]*AnnounceRule{
+		"found": {Param: "rover.position", When: "valid", Say: "Rover found", States: []string{"Run"}},
+		"lost":  {Param: "rover.position", When: "stale", Say: "Rover lost", States: []string{"Run"}},
+	})
+	a.Validity(rover, true, "Run")
+	a.Validity(rover, false, "Hold")
+	assert.Equal(t, []string{"Rover found"}, drain(audio))
+}
+
+func TestAnnounceSpeed(t *testing.T) {
+	a, audio, ps := newTestAnnouncer()
+	vog := ps.NewNum("gps.vog")
+
+	vog.SetFloat64(0.1)
+	a.Update(vog, "Run")
+	assert.Nil(t, drain(audio))
+
+	// Rate limited.
+	vog.SetFloat64(10)
+	a.Update(vog, "Run")
+	vog.SetFloat64(11)
+	a.Update(vog, "Run")
+	assert.Equal(t, []string{"36 kph"}, drain(audio))
+	assert.Contains(t, Phrases(nil), "36 kph")
+
+	// Only in Run.
+	a.Configure(nil)
+	a.Update(vog, "Hold")
+	assert.Nil(t, drain(audio))
+}
+
+func TestAnnounceConfig(t *testing.T) {
+	a, audio, ps := newTestAnnouncer()
+	rover := ps.NewTyped("rover.position", (*NEUPosition)(nil))
+	battery := ps.NewNum("rover.battery.remaining")
+	battery.SetFloat64(73)
+
+	err := a.Configure(map[string]*AnnounceRule{
+		"state": {Say: ""},
+		"high": {
+			Param:    "rover.position.up",
+			When:     "crosses",
+			Value:    100,
+			Say:      `{{if ge .Value 100.0}}Above{{else}}Below{{end}} {{.Value}} m, battery {{param "rover.battery.remaining"}}`,
+			Priority: "safety",
+		},
+		"broken": {Param: "state", When: "sometimes", Say: "Never"},
+	})
+	assert.NotNil(t, err)
+	assert.NotContains(t, a.Phrases(), "{{.Text}}")
+
+	for _, up := range []float64{50, 99, 101, 120, 80} {
+		rover.Set(&NEUPosition{Up: up})
+		a.Update(rover, "Run")
+	}
+	assert.Equal(t, []string{"Above 101 m, battery 73", "Below 80 m, battery 73"}, drain(audio))
+
+	state := ps.NewNum("state", &param.Meta{Enum: stateNames()})
+	a.Update(state, "Run")
+	assert.Nil(t, drain(audio))
+}
+
+func TestAnnounceMissingParam(t *testing.T) {
+	a, _, ps := newTestAnnouncer()
+	added := make(map[string]bool)
+	for _, r := range defaultAnnounceRules {
+		if !added[r.Param] {
+			ps.NewNum(r.Param)
+			added[r.Param] = true
+		}
+	}
+	ps.NewTyped("rover.position", (*NEUPosition)(nil))
+	ps.New("remote")
+
+	for _, name := range []string{"rover.position", "rover.position.up", "remote.anything"} {
+		err := a.Configure(map[string]*AnnounceRule{
+			"ok": {Param: name, When: "update", Say: "Ok"},
+		})
+		assert.Nil(t, err, name)
+	}
+
+	for _, name := range []string{"rover.position.alt", "rover.nothing", "rover"} {
+		err := a.Configure(map[string]*AnnounceRule{
+			"bad": {Param: name, When: "update", Say: "Bad"},
+		})
+		assert.EqualError(t, err, "announce.bad: No param or leaf "+name)
+	}
+}
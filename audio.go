@@ -17,47 +17,394 @@ package pipoint
 
 import (
 	"fmt"
+	"io/ioutil"
+	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"juju.nz/x/pipoint/util"
 )
 
-// AudioOut can play files or speech.
+// Priority orders announcements.  Higher priorities are said first
+// and are kept for longer.
+type Priority int
+
+const (
+	// PriorityInfo is for routine information such as the speed.
+	PriorityInfo Priority = iota
+	// PriorityState is for state changes such as "GPS ready".
+	PriorityState
+	// PrioritySafety is for problems such as "Rover offline".
+	PrioritySafety
+)
+
+const (
+	// audioQueue is the most announcements waiting to be said.
+	audioQueue = 10
+	// PhraseDir holds the pre-rendered phrases.  See PhrasePath.
+	PhraseDir = "phrase"
+)
+
+// audioMaxAge is how long an announcement of each priority stays
+// worth saying.
+var audioMaxAge = map[Priority]time.Duration{
+	PriorityInfo:   5 * time.Second,
+	PriorityState:  10 * time.Second,
+	PrioritySafety: 30 * time.Second,
+}
+
+// announcement is a phrase waiting to be said.
+type announcement struct {
+	priority Priority
+	text     string
+	queued   time.Time
+}
+
+// AudioBackend plays sounds.  All methods return when done.
+type AudioBackend interface {
+	// Play plays a WAV file, or an Ogg file rendered by older
+	// versions.
+	Play(path string) error
+	// Speak says text that has no pre-rendered phrase.
+	Speak(text string) error
+	// SetVolume sets the output volume in percent.
+	SetVolume(percent float64) error
+}
+
+// CommandBackend plays sounds by running commands.  Each command is
+// split on spaces and then "{file}", "{text}", and "{percent}" are
+// replaced.
+type CommandBackend struct {
+	PlayCommand string
+	// PlayOggCommand plays the Ogg files rendered by older versions,
+	// or is empty to use PlayCommand.
+	PlayOggCommand string
+	// SpeakCommand says "{text}".  If it uses "{file}" then it
+	// writes the speech to that WAV file which is then played.
+	SpeakCommand string
+	// VolumeCommand sets the volume, or is empty if the volume
+	// can't be changed.
+	VolumeCommand string
+}
+
+// NewALSABackend returns the commands that play sounds on an ALSA
+// device such as "default" or "hw:0" using aplay, ogg123, espeak, and
+// amixer.
+func NewALSABackend(device string) *CommandBackend {
+	return &CommandBackend{
+		PlayCommand:    "aplay -q -D " + device + " {file}",
+		PlayOggCommand: "ogg123 -q -d alsa -o dev:" + device + " {file}",
+		SpeakCommand:   "espeak -w {file} {text}",
+		VolumeCommand:  "amixer -q -D " + device + " set PCM {percent}%",
+	}
+}
+
+// Play runs PlayCommand, or PlayOggCommand for Ogg files, on the
+// file.
+func (b *CommandBackend) Play(path string) error {
+	command := b.PlayCommand
+	if filepath.Ext(path) == ".ogg" && b.PlayOggCommand != "" {
+		command = b.PlayOggCommand
+	}
+	return expandCommand(command, map[string]string{"file": path}).Run()
+}
+
+// Speak runs SpeakCommand on the text.
+func (b *CommandBackend) Speak(text string) error {
+	if !strings.Contains(b.SpeakCommand, "{file}") {
+		return expandCommand(b.SpeakCommand, map[string]string{"text": text}).Run()
+	}
+
+	f, err := ioutil.TempFile("", "pipoint")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	if err := expandCommand(b.SpeakCommand, map[string]string{"file": f.Name(), "text": text}).Run(); err != nil {
+		return err
+	}
+	return b.Play(f.Name())
+}
+
+// SetVolume runs VolumeCommand, if any.
+func (b *CommandBackend) SetVolume(percent float64) error {
+	if b.VolumeCommand == "" {
+		return nil
+	}
+	return expandCommand(b.VolumeCommand, map[string]string{"percent": fmt.Sprintf("%.0f", percent)}).Run()
+}
+
+// NullBackend discards all sounds.
+type NullBackend struct{}
+
+// Play does nothing.
+func (b NullBackend) Play(path string) error { return nil }
+
+// Speak does nothing.
+func (b NullBackend) Speak(text string) error { return nil }
+
+// SetVolume does nothing.
+func (b NullBackend) SetVolume(percent float64) error { return nil }
+
+// NewAudioBackend returns the backend with the given name, which is
+// one of alsa, command, or null.  The device is only used by the alsa
+// backend and the commands by the command backend.
+func NewAudioBackend(name, device, play, speak, volume string) (AudioBackend, error) {
+	switch name {
+	case "alsa":
+		return NewALSABackend(device), nil
+	case "command":
+		return &CommandBackend{PlayCommand: play, SpeakCommand: speak, VolumeCommand: volume}, nil
+	case "null":
+		return NullBackend{}, nil
+	default:
+		return nil, fmt.Errorf("Unknown audio backend %q", name)
+	}
+}
+
+// expandCommand splits the template on spaces and replaces each
+// "{name}" with the value from vars.
+func expandCommand(template string, vars map[string]string) *exec.Cmd {
+	args := strings.Fields(template)
+	for i, arg := range args {
+		for name, value := range vars {
+			arg = strings.Replace(arg, "{"+name+"}", value, -1)
+		}
+		args[i] = arg
+	}
+	if len(args) == 0 {
+		args = []string{"true"}
+	}
+	return exec.Command(args[0], args[1:]...)
+}
+
+// PhrasePath returns the path of the pre-rendered phrase for text.
+func PhrasePath(dir, text string) string {
+	return filepath.Join(dir, util.NormText(text)+".wav")
+}
+
+// findPhrase returns the pre-rendered phrase for text, falling back
+// to the Ogg files used by older versions, or "" if there is none.
+func findPhrase(dir, text string) string {
+	wav := PhrasePath(dir, text)
+	ogg := strings.TrimSuffix(wav, ".wav") + ".ogg"
+	for _, path := range []string{wav, ogg} {
+		if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() {
+			return path
+		}
+	}
+	return ""
+}
+
+// RenderPhrase renders text into dir by running the tts command
+// template, where "{text}" is the text and "{file}" is the WAV file
+// to write.
+func RenderPhrase(dir, tts, text string) error {
+	path := PhrasePath(dir, text)
+	temp := path + ".tmp"
+
+	cmd := expandCommand(tts, map[string]string{"file": temp, "text": text})
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("%v: %v %s", text, err, strings.TrimSpace(string(out)))
+	}
+	return os.Rename(temp, path)
+}
+
+// AudioOut can play files or speech.  Announcements are queued by
+// priority and are dropped if they wait for too long.
 type AudioOut struct {
-	queued chan *exec.Cmd
+	mu      sync.Mutex
+	pending []*announcement
+	muted   bool
+	backend AudioBackend
+	// volume is the volume to set, or negative if unchanged.
+	volume float64
+	wake   chan bool
+
+	// play says the text and returns when done.
+	play func(text string)
+	// now returns the current time.
+	now func() time.Time
 }
 
 // NewAudioOut creates a new, running audio output.
-func NewAudioOut() *AudioOut {
+func NewAudioOut(backend AudioBackend) *AudioOut {
+	a := newAudioOut(backend)
+	go a.run()
+	return a
+}
+
+func newAudioOut(backend AudioBackend) *AudioOut {
 	a := &AudioOut{
-		queued: make(chan *exec.Cmd, 10),
+		backend: backend,
+		volume:  -1,
+		wake:    make(chan bool, 1),
+		now:     time.Now,
 	}
-	go a.run()
+	a.play = a.say
 	return a
 }
 
-// Play plays an audio file.
-func (a *AudioOut) Play(path string) {
-	a.queued <- exec.Command("ogg123", path)
+// SetBackend changes how sounds are played.
+func (a *AudioOut) SetBackend(backend AudioBackend) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.backend = backend
+}
+
+// Play plays an audio file and returns when done.
+func (a *AudioOut) Play(path string) error {
+	a.mu.Lock()
+	backend := a.backend
+	a.mu.Unlock()
+	return backend.Play(path)
 }
 
-// Say plays a pre-recorded phrase, or falls back to espeak.
-func (a *AudioOut) Say(text string) {
-	rendered := fmt.Sprintf("phrase/%s.ogg", util.NormText(text))
-	fi, err := os.Stat(rendered)
+// say plays a pre-rendered phrase, or falls back to speech.
+func (a *AudioOut) say(text string) {
+	a.mu.Lock()
+	backend := a.backend
+	a.mu.Unlock()
 
-	if err == nil && fi.Mode().IsRegular() {
-		a.Play(rendered)
+	var err error
+	if rendered := findPhrase(PhraseDir, text); rendered != "" {
+		err = backend.Play(rendered)
 	} else {
-		a.queued <- exec.Command("espeak", text)
+		err = backend.Speak(text)
+	}
+	if err != nil {
+		log.Printf("audio: %q: %v\n", text, err)
+	}
+}
+
+// Say queues text to be said and returns immediately.  Text that is
+// already waiting is not queued again.  If the queue is full then
+// the oldest of the lowest priority announcements is dropped.
+func (a *AudioOut) Say(priority Priority, text string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.muted {
+		return
+	}
+
+	now := a.now()
+	for _, item := range a.pending {
+		if item.text == text {
+			item.queued = now
+			if priority > item.priority {
+				item.priority = priority
+			}
+			return
+		}
+	}
+
+	if len(a.pending) >= audioQueue {
+		lowest := 0
+		for i, item := range a.pending {
+			if item.priority < a.pending[lowest].priority {
+				lowest = i
+			}
+		}
+		if a.pending[lowest].priority > priority {
+			log.Printf("audio: dropped %q\n", text)
+			return
+		}
+		log.Printf("audio: dropped %q\n", a.pending[lowest].text)
+		a.pending = append(a.pending[:lowest], a.pending[lowest+1:]...)
+	}
+
+	a.pending = append(a.pending, &announcement{priority, text, now})
+
+	select {
+	case a.wake <- true:
+	default:
+	}
+}
+
+// SetMute drops all queued and future announcements while muted.
+func (a *AudioOut) SetMute(muted bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.muted = muted
+	if muted {
+		a.pending = nil
+	}
+}
+
+// SetVolume sets the output volume in percent.  The volume is
+// changed by the audio goroutine so that a slow mixer doesn't block
+// the caller.
+func (a *AudioOut) SetVolume(percent float64) {
+	a.mu.Lock()
+	a.volume = percent
+	a.mu.Unlock()
+
+	select {
+	case a.wake <- true:
+	default:
+	}
+}
+
+// applyVolume passes any new volume to the backend.
+func (a *AudioOut) applyVolume() {
+	a.mu.Lock()
+	backend, volume := a.backend, a.volume
+	a.volume = -1
+	a.mu.Unlock()
+
+	if volume < 0 {
+		return
+	}
+	if err := backend.SetVolume(volume); err != nil {
+		log.Printf("audio: volume: %v\n", err)
+	}
+}
+
+// next removes and returns the highest priority announcement that
+// isn't stale, or nil if there are none.
+func (a *AudioOut) next() *announcement {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	var fresh []*announcement
+	for _, item := range a.pending {
+		if now.Sub(item.queued) <= audioMaxAge[item.priority] {
+			fresh = append(fresh, item)
+		}
+	}
+	a.pending = fresh
+
+	if len(a.pending) == 0 {
+		return nil
+	}
+
+	best := 0
+	for i, item := range a.pending {
+		if item.priority > a.pending[best].priority {
+			best = i
+		}
 	}
+	item := a.pending[best]
+	a.pending = append(a.pending[:best], a.pending[best+1:]...)
+	return item
 }
 
-// run executes the commands to play the sounds.
+// run says the queued announcements.
 func (a *AudioOut) run() {
-	for {
-		cmd := <-a.queued
-		cmd.Run()
+	for range a.wake {
+		a.applyVolume()
+		for item := a.next(); item != nil; item = a.next() {
+			a.play(item.text)
+		}
 	}
 }
@@ -0,0 +1,280 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// drain returns the text of every announcement in the order said.
+func drain(a *AudioOut) []string {
+	var said []string
+	for item := a.next(); item != nil; item = a.next() {
+		said = append(said, item.text)
+	}
+	return said
+}
+
+func TestAudioPriority(t *testing.T) {
+	a := newAudioOut(NullBackend{})
+
+	a.Say(PriorityInfo, "10 kph")
+	a.Say(PriorityState, "Run")
+	a.Say(PrioritySafety, "Rover lost")
+	a.Say(PriorityState, "GPS ready")
+
+	assert.Equal(t, []string{"Rover lost", "Run", "GPS ready", "10 kph"}, drain(a))
+}
+
+func TestAudioDuplicates(t *testing.T) {
+	a := newAudioOut(NullBackend{})
+
+	a.Say(PrioritySafety, "Rover offline")
+	a.Say(PrioritySafety, "Rover ready")
+	a.Say(PrioritySafety, "Rover offline")
+	a.Say(PriorityInfo, "Run")
+	a.Say(PriorityState, "Run")
+
+	assert.Equal(t, []string{"Rover offline", "Rover ready", "Run"}, drain(a))
+}
+
+func TestAudioStale(t *testing.T) {
+	now := time.Unix(1000, 0)
+	a := newAudioOut(NullBackend{})
+	a.now = func() time.Time { return now }
+
+	a.Say(PriorityInfo, "10 kph")
+	a.Say(PriorityState, "Run")
+	a.Say(PrioritySafety, "Rover lost")
+
+	now = now.Add(8 * time.Second)
+	assert.Equal(t, []string{"Rover lost", "Run"}, drain(a))
+
+	a.Say(PrioritySafety, "Rover lost")
+	now = now.Add(time.Minute)
+	assert.Nil(t, drain(a))
+}
+
+func TestAudioQueueLimit(t *testing.T) {
+	a := newAudioOut(NullBackend{})
+
+	a.Say(PrioritySafety, "Rover lost")
+	for i := 0; i < audioQueue; i++ {
+		a.Say(PriorityInfo, fmt.Sprintf("%d kph", i))
+	}
+	// Full of safety and info, so a new state replaces the oldest
+	// info.
+	a.Say(PriorityState, "Run")
+
+	said := drain(a)
+	assert.Equal(t, audioQueue, len(said))
+	assert.Equal(t, []string{"Rover lost", "Run", "2 kph"}, said[:3])
+
+	for i := 0; i < audioQueue; i++ {
+		a.Say(PrioritySafety, fmt.Sprintf("Alert %d", i))
+	}
+	a.Say(PriorityInfo, "10 kph")
+	said = drain(a)
+	assert.Equal(t, audioQueue, len(said))
+	assert.NotContains(t, said, "10 kph")
+}
+
+func TestAudioMute(t *testing.T) {
+	a := newAudioOut(NullBackend{})
+
+	a.Say(PriorityState, "Run")
+	a.SetMute(true)
+	a.Say(PrioritySafety, "Rover lost")
+	assert.Nil(t, drain(a))
+
+	a.SetMute(false)
+	a.Say(PrioritySafety, "Rover lost")
+	assert.Equal(t, []string{"Rover lost"}, drain(a))
+}
+
+func TestAudioRun(t *testing.T) {
+	a := newAudioOut(NullBackend{})
+	said := make(chan string, audioQueue)
+	a.play = func(text string) { said <- text }
+	go a.run()
+
+	a.Say(PriorityState, "Base ready")
+
+	select {
+	case text := <-said:
+		assert.Equal(t, "Base ready", text)
+	case <-time.After(time.Second):
+		t.Fatal("Not said")
+	}
+}
+
+// recorder is an audio backend that records what was played.
+type recorder struct {
+	played []string
+}
+
+func (r *recorder) Play(path string) error {
+	r.played = append(r.played, "play "+filepath.Base(path))
+	return nil
+}
+
+func (r *recorder) Speak(text string) error {
+	r.played = append(r.played, "speak "+text)
+	return nil
+}
+
+func (r *recorder) SetVolume(percent float64) error {
+	r.played = append(r.played, fmt.Sprintf("volume %v", percent))
+	return nil
+}
+
+func TestAudioBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "phrase")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	os.Chdir(dir)
+	os.Mkdir(PhraseDir, 0755)
+
+	assert.Nil(t, RenderPhrase(PhraseDir, "cp /dev/null {file}", "Rover lost"))
+	_, err = os.Stat(PhrasePath(PhraseDir, "Rover lost"))
+	assert.Nil(t, err)
+
+	// Phrases from older versions are still played.
+	ogg := strings.TrimSuffix(PhrasePath(PhraseDir, "GPS ready"), ".wav") + ".ogg"
+	assert.Nil(t, ioutil.WriteFile(ogg, nil, 0644))
+
+	r := &recorder{}
+	a := newAudioOut(r)
+	a.say("Rover lost")
+	a.say("Run")
+	a.say("GPS ready")
+	assert.Equal(t, []string{"play rover_lost-361a.wav", "speak Run", "play " + filepath.Base(ogg)}, r.played)
+}
+
+func TestRenderPhraseFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "phrase")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NotNil(t, RenderPhrase(dir, "false {file}", "Run"))
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 0, len(files))
+}
+
+func TestCommandBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "phrase")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out")
+	b, err := NewAudioBackend("command", "", "cp {file} "+out, "false", "")
+	assert.Nil(t, err)
+	assert.Nil(t, b.Play("/dev/null"))
+	_, err = os.Stat(out)
+	assert.Nil(t, err)
+	assert.NotNil(t, b.Speak("Run"))
+	assert.Nil(t, b.SetVolume(50))
+
+	_, err = NewAudioBackend("speaker", "", "", "", "")
+	assert.NotNil(t, err)
+}
+
+func TestCommandBackendFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "phrase")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	speech := filepath.Join(dir, "speech.wav")
+	assert.Nil(t, ioutil.WriteFile(speech, []byte("Run"), 0644))
+	wav := filepath.Join(dir, "wav")
+	ogg := filepath.Join(dir, "ogg")
+
+	// Speech is written to a file and then played.
+	b := &CommandBackend{
+		PlayCommand:    "cp {file} " + wav,
+		PlayOggCommand: "cp {file} " + ogg,
+		SpeakCommand:   "cp " + speech + " {file}",
+	}
+	assert.Nil(t, b.Speak("Run"))
+	played, err := ioutil.ReadFile(wav)
+	assert.Nil(t, err)
+	assert.Equal(t, "Run", string(played))
+
+	// Ogg files have their own command.
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "speech.ogg"), []byte("Ogg"), 0644))
+	assert.Nil(t, b.Play(filepath.Join(dir, "speech.ogg")))
+	played, err = ioutil.ReadFile(ogg)
+	assert.Nil(t, err)
+	assert.Equal(t, "Ogg", string(played))
+
+	alsa, err := NewAudioBackend("alsa", "hw:1", "", "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, NewALSABackend("hw:1"), alsa)
+	assert.Contains(t, alsa.(*CommandBackend).PlayCommand, "-D hw:1 ")
+}
+
+func TestPhrases(t *testing.T) {
+	phrases := Phrases(nil)
+	assert.Contains(t, phrases, "Rover offline")
+	assert.Contains(t, phrases, "Run")
+	assert.Contains(t, phrases, "12 kph")
+
+	// Static phrases from configured rules, but not templates.
+	phrases = Phrases(map[string]*AnnounceRule{
+		"high": {
+			Param: "rover.relative.height",
+			When:  "above",
+			Value: 120,
+			Say:   "Too high",
+		},
+		"down":     {Param: "link.status", When: "equals", Value: 2, Say: "Rover offline"},
+		"distance": {Param: "rover.relative.distance", When: "update", Say: "{{.Value}} metres"},
+	})
+	assert.Contains(t, phrases, "Too high")
+	assert.Contains(t, phrases, "Run")
+	assert.NotContains(t, phrases, "{{.Value}} metres")
+
+	// Every phrase has its own file.
+	seen := make(map[string]string)
+	for _, text := range phrases {
+		path := PhrasePath(PhraseDir, text)
+		assert.Equal(t, "", seen[path], text)
+		seen[path] = text
+	}
+}
+
+func TestAudioVolume(t *testing.T) {
+	r := &recorder{}
+	a := newAudioOut(r)
+	a.SetVolume(50)
+	a.SetVolume(80)
+	assert.Nil(t, r.played)
+
+	a.applyVolume()
+	a.applyVolume()
+	assert.Equal(t, []string{"volume 80"}, r.played)
+}
@@ -0,0 +1,231 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"juju.nz/x/pipoint/param"
+)
+
+const (
+	// dashboardBuffer is the number of updates buffered per
+	// client before updates are dropped.
+	dashboardBuffer = 100
+)
+
+// dashboardEvent is a param update sent to web clients.
+type dashboardEvent struct {
+	Name  string
+	Ok    bool
+	Value interface{}
+}
+
+// Dashboard is a web UI that shows the live params and has controls
+// for the common commands.
+type Dashboard struct {
+	pi      *PiPoint
+	updates *param.Subscription
+
+	mu      sync.Mutex
+	clients map[chan []byte]bool
+}
+
+// NewDashboard creates a new dashboard and adds the handlers to mux
+// under /dashboard/.
+func NewDashboard(pi *PiPoint, mux *http.ServeMux) *Dashboard {
+	d := &Dashboard{
+		pi:      pi,
+		clients: make(map[chan []byte]bool),
+	}
+
+	mux.HandleFunc("/dashboard/", d.index)
+	mux.HandleFunc("/dashboard/events", d.events)
+	mux.HandleFunc("/dashboard/mark", d.post(d.mark))
+	mux.HandleFunc("/dashboard/state", d.post(d.state))
+	mux.HandleFunc("/dashboard/nudge", d.post(d.nudge))
+	mux.HandleFunc("/dashboard/save", d.post(d.save))
+
+	d.updates = pi.Params.Subscribe(&param.SubscribeOptions{
+		Name: "dashboard",
+		Size: dashboardBuffer,
+	})
+	go d.run()
+	return d
+}
+
+func encodeEvent(p *param.Param) ([]byte, error) {
+	return json.Marshal(&dashboardEvent{
+		Name:  p.Name,
+		Ok:    p.Ok(),
+		Value: p.Get(),
+	})
+}
+
+// run fans updates out to all clients.  Slow clients miss updates
+// instead of blocking the params.
+func (d *Dashboard) run() {
+	for p := range d.updates.C {
+		msg, err := encodeEvent(p)
+		if err != nil {
+			continue
+		}
+
+		d.mu.Lock()
+		for client := range d.clients {
+			select {
+			case client <- msg:
+			default:
+			}
+		}
+		d.mu.Unlock()
+	}
+}
+
+func (d *Dashboard) index(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/dashboard/" {
+		http.NotFound(w, req)
+		return
+	}
+
+	var states []string
+	for i := range d.pi.states {
+		states = append(states, stateName(i))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dashboardTemplate.Execute(w, map[string]interface{}{
+		"States":  states,
+		"Version": Version,
+	})
+}
+
+// events streams all params then updates as server sent events.
+func (d *Dashboard) events(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	client := make(chan []byte, dashboardBuffer)
+	d.mu.Lock()
+	d.clients[client] = true
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		delete(d.clients, client)
+		d.mu.Unlock()
+	}()
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+
+	for _, p := range d.pi.Params.All() {
+		if msg, err := encodeEvent(p); err == nil {
+			fmt.Fprintf(w, "data: %s\n\n", msg)
+		}
+	}
+	flusher.Flush()
+
+	closed := req.Context().Done()
+
+	for {
+		select {
+		case msg := <-client:
+			fmt.Fprintf(w, "data: %s\n\n", msg)
+			flusher.Flush()
+		case <-closed:
+			return
+		}
+	}
+}
+
+// post wraps an action so that it only accepts POSTs.
+func (d *Dashboard) post(action func(req *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "POST" {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := action(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// formFloat parses an optional float form value.
+func formFloat(req *http.Request, name string) (float64, error) {
+	value := req.FormValue(name)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func (d *Dashboard) mark(req *http.Request) error {
+	return d.pi.mark.Inc()
+}
+
+func (d *Dashboard) state(req *http.Request) error {
+	state, err := strconv.Atoi(req.FormValue("value"))
+	if err != nil {
+		return err
+	}
+	if state < 0 || state >= len(d.pi.states) {
+		return fmt.Errorf("State %d is out of range", state)
+	}
+	return d.pi.state.SetInt(state)
+}
+
+func (d *Dashboard) save(req *http.Request) error {
+	return d.pi.save.Inc()
+}
+
+// nudge adjusts the pan/tilt offset by the given yaw and pitch in
+// radians.
+func (d *Dashboard) nudge(req *http.Request) error {
+	yaw, err := formFloat(req, "yaw")
+	if err != nil {
+		return err
+	}
+	pitch, err := formFloat(req, "pitch")
+	if err != nil {
+		return err
+	}
+
+	offset, ok := d.pi.offset.Value()
+	if !ok {
+		return errors.New("No offset")
+	}
+	return d.pi.offset.Set(&Attitude{
+		Roll:  offset.Roll,
+		Pitch: offset.Pitch + pitch,
+		Yaw:   offset.Yaw + yaw,
+	})
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(dashboardHTML))
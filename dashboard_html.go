@@ -0,0 +1,247 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+// dashboardHTML is the single page dashboard.  It listens to
+// /dashboard/events and posts commands back.
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>pipoint</title>
+<style>
+body { font-family: sans-serif; margin: 1em; background: #f4f4f4; }
+.panel { display: inline-block; vertical-align: top; background: #fff; margin: 0.5em; padding: 0.5em 1em; border-radius: 4px; }
+.big { font-size: 2em; font-weight: bold; }
+.ok { color: #2a2; }
+.bad { color: #c22; }
+button { font-size: 1.2em; margin: 0.2em; min-width: 3em; }
+canvas { border: 1px solid #ccc; }
+td { padding: 0 0.5em; }
+</style>
+</head>
+<body>
+<h1>pipoint <small>{{.Version}}</small></h1>
+
+<div class="panel">
+  <div>State</div><div class="big" id="state">-</div>
+  <div>Link</div><div class="big" id="link">-</div>
+  <div>GPS fix</div><div class="big" id="fix">-</div>
+  <div>Speed</div><div class="big" id="vog">-</div>
+</div>
+
+<div class="panel">
+  <div>Rover relative to base (m)</div>
+  <canvas id="ltp" width="300" height="300"></canvas>
+  <div id="range">-</div>
+</div>
+
+<div class="panel">
+  <div>Pan and tilt</div>
+  <table>
+    <tr><th></th><th>sp (rad)</th><th>pv (ms)</th></tr>
+    <tr><td>Pan</td><td id="pan.sp">-</td><td id="pan.pv">-</td></tr>
+    <tr><td>Tilt</td><td id="tilt.sp">-</td><td id="tilt.pv">-</td></tr>
+  </table>
+  <canvas id="servos" width="300" height="150"></canvas>
+  <div>Offset <span id="offset">-</span></div>
+</div>
+
+<div class="panel">
+  <div>Commands</div>
+  <button onclick="post('mark')">Mark</button>
+  <div>
+  {{range $i, $name := .States}}<button onclick="post('state', {value: {{$i}}})">{{$name}}</button>
+  {{end}}
+  </div>
+  <div>Nudge</div>
+  <button onclick="nudge(-1, 0)">&larr;</button>
+  <button onclick="nudge(1, 0)">&rarr;</button>
+  <button onclick="nudge(0, 1)">&uarr;</button>
+  <button onclick="nudge(0, -1)">&darr;</button>
+  <div><button onclick="post('save')">Save</button></div>
+  <div id="error" class="bad"></div>
+</div>
+
+<script>
+var states = [{{range .States}}{{.}}, {{end}}];
+var params = {};
+var traces = {pan: [], tilt: []};
+var step = Math.PI / 180;
+
+function post(action, values) {
+  var body = new URLSearchParams(values || {});
+  fetch('/dashboard/' + action, {method: 'POST', body: body}).then(function(r) {
+    if (!r.ok) {
+      r.text().then(function(t) { document.getElementById('error').textContent = t; });
+    } else {
+      document.getElementById('error').textContent = '';
+    }
+  });
+}
+
+function nudge(yaw, pitch) {
+  post('nudge', {yaw: yaw * step, pitch: pitch * step});
+}
+
+function set(id, text, ok) {
+  var el = document.getElementById(id);
+  el.textContent = text;
+  el.className = ok === undefined ? '' : (ok ? 'ok' : 'bad');
+}
+
+function value(name) {
+  var p = params[name];
+  return p ? p.Value : null;
+}
+
+function drawLTP() {
+  var c = document.getElementById('ltp');
+  var ctx = c.getContext('2d');
+  var rover = value('rover.position');
+  var base = value('base.position');
+  ctx.clearRect(0, 0, c.width, c.height);
+  ctx.strokeStyle = '#ddd';
+  ctx.beginPath();
+  ctx.moveTo(c.width / 2, 0); ctx.lineTo(c.width / 2, c.height);
+  ctx.moveTo(0, c.height / 2); ctx.lineTo(c.width, c.height / 2);
+  ctx.stroke();
+  ctx.fillStyle = '#000';
+  ctx.fillText('N', c.width / 2 + 4, 12);
+  ctx.fillRect(c.width / 2 - 4, c.height / 2 - 4, 8, 8);
+  if (!rover || !base) {
+    return;
+  }
+  var north = rover.North - base.North;
+  var east = rover.East - base.East;
+  var dist = Math.sqrt(north * north + east * east);
+  var scale = Math.pow(10, Math.ceil(Math.log10(Math.max(dist, 10))));
+  var px = c.width / 2 / scale;
+  ctx.fillStyle = params['rover.position'].Ok ? '#1f77b4' : '#c22';
+  ctx.beginPath();
+  ctx.arc(c.width / 2 + east * px, c.height / 2 - north * px, 6, 0, 2 * Math.PI);
+  ctx.fill();
+  ctx.fillStyle = '#000';
+  ctx.fillText(scale + ' m', c.width - 50, c.height - 4);
+  set('range', dist.toFixed(0) + ' m, ' + (rover.Up - base.Up).toFixed(0) + ' m up');
+}
+
+function drawServos() {
+  var c = document.getElementById('servos');
+  var ctx = c.getContext('2d');
+  ctx.clearRect(0, 0, c.width, c.height);
+  var colours = {pan: '#1f77b4', tilt: '#ff7f0e'};
+  ['pan', 'tilt'].forEach(function(axis) {
+    var h = traces[axis];
+    ctx.strokeStyle = colours[axis];
+    [['sp', -Math.PI, Math.PI, []], ['pv', 0.5, 2.5, [4, 2]]].forEach(function(series) {
+      ctx.setLineDash(series[3]);
+      ctx.beginPath();
+      h.forEach(function(s, i) {
+        var v = s[series[0]];
+        var y = c.height - (v - series[1]) / (series[2] - series[1]) * c.height;
+        if (i == 0) ctx.moveTo(i, y); else ctx.lineTo(i, y);
+      });
+      ctx.stroke();
+    });
+  });
+  ctx.setLineDash([]);
+}
+
+function sample() {
+  ['pan', 'tilt'].forEach(function(axis) {
+    var h = traces[axis];
+    h.push({sp: value('pantilt.' + axis + '.sp') || 0, pv: value('pantilt.' + axis + '.pv') || 0});
+    if (h.length > 300) h.shift();
+  });
+  drawServos();
+}
+
+function update(p) {
+  params[p.Name] = p;
+  var v = p.Value;
+  switch (p.Name) {
+  case 'state':
+    set('state', states[v] || v);
+    break;
+  case 'link.status':
+    set('link', ['Unknown', 'Online', 'Offline'][v] || v, v == 1);
+    break;
+  case 'gps.fix':
+    set('fix', v, v >= 3);
+    break;
+  case 'gps.vog':
+    set('vog', (v * 3.6).toFixed(0) + ' kph');
+    break;
+  case 'pantilt.pan.sp':
+  case 'pantilt.pan.pv':
+  case 'pantilt.tilt.sp':
+  case 'pantilt.tilt.pv':
+    set(p.Name.substring(8), v.toFixed(3));
+    break;
+  case 'pantilt.offset':
+    set('offset', 'yaw ' + (v.Yaw * 180 / Math.PI).toFixed(1) + '° pitch ' + (v.Pitch * 180 / Math.PI).toFixed(1) + '°');
+    break;
+  case 'rover.position':
+  case 'base.position':
+    drawLTP();
+    break;
+  }
+}
+
+// prefill loads the recent servo values so that the plot starts full.
+function prefill() {
+  var names = ['pan.sp', 'pan.pv', 'tilt.sp', 'tilt.pv'];
+  Promise.all(names.map(function(name) {
+    return fetch('/params/pantilt/' + name.replace('.', '/') + '?history=30s').then(function(r) {
+      return r.ok ? r.json() : [];
+    });
+  })).then(function(all) {
+    var end = 0;
+    all.forEach(function(samples) {
+      samples.forEach(function(s) { end = Math.max(end, Date.parse(s.Time)); });
+    });
+    ['pan', 'tilt'].forEach(function(axis, i) {
+      var sp = all[i * 2], pv = all[i * 2 + 1];
+      var h = [];
+      for (var t = end - 30000; t <= end; t += 100) {
+        h.push({sp: at(sp, t), pv: at(pv, t)});
+      }
+      traces[axis] = h.concat(traces[axis]).slice(-300);
+    });
+    drawServos();
+  });
+}
+
+// at returns the last sample value at or before t.
+function at(samples, t) {
+  var v = 0;
+  samples.forEach(function(s) {
+    if (Date.parse(s.Time) <= t) v = s.Value;
+  });
+  return v;
+}
+
+prefill();
+var events = new EventSource('/dashboard/events');
+events.onmessage = function(e) { update(JSON.parse(e.data)); };
+events.onerror = function() { set('link', 'No base', false); };
+setInterval(sample, 100);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,87 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"juju.nz/x/pipoint/param"
+)
+
+func newTestDashboard() (*PiPoint, *http.ServeMux) {
+	pi := &PiPoint{Params: &param.Params{}}
+	pi.states = newStates(pi)
+	pi.state = pi.Params.NewNum("state")
+	pi.mark = pi.Params.NewNum("mark")
+	pi.save = pi.Params.NewNum("save")
+	pi.offset = AttitudeParam{pi.Params.NewWith("pantilt.offset", &Attitude{Yaw: 1})}
+
+	mux := http.NewServeMux()
+	NewDashboard(pi, mux)
+	return pi, mux
+}
+
+func post(mux *http.ServeMux, path string, values url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestDashboardIndex(t *testing.T) {
+	_, mux := newTestDashboard()
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/dashboard/", nil))
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Contains(t, w.Body.String(), ">Orientate</button>")
+}
+
+func TestDashboardState(t *testing.T) {
+	pi, mux := newTestDashboard()
+
+	w := post(mux, "/dashboard/state", url.Values{"value": {"2"}})
+	assert.Equal(t, w.Code, http.StatusNoContent)
+	assert.Equal(t, pi.state.GetInt(), 2)
+
+	// Out of range states are rejected.
+	w = post(mux, "/dashboard/state", url.Values{"value": {"17"}})
+	assert.Equal(t, w.Code, http.StatusBadRequest)
+	assert.Equal(t, pi.state.GetInt(), 2)
+
+	// Only POSTs are accepted.
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/dashboard/state?value=1", nil))
+	assert.Equal(t, w.Code, http.StatusMethodNotAllowed)
+}
+
+func TestDashboardNudge(t *testing.T) {
+	pi, mux := newTestDashboard()
+
+	post(mux, "/dashboard/mark", nil)
+	assert.Equal(t, pi.mark.GetInt(), 1)
+
+	post(mux, "/dashboard/nudge", url.Values{"yaw": {"0.5"}, "pitch": {"-0.25"}})
+	offset := pi.offset.Get().(*Attitude)
+	assert.Equal(t, offset.Yaw, 1.5)
+	assert.Equal(t, offset.Pitch, -0.25)
+}
@@ -16,24 +16,112 @@
 package pipoint
 
 import (
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
+
+	"juju.nz/x/pipoint/param"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	elogWritten = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pipoint_elog_written_bytes_total",
+		Help: "Bytes written to the event log.",
+	})
+	elogDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pipoint_elog_dropped_bytes_total",
+		Help: "Bytes dropped due to the event log buffer being full.",
+	})
 )
 
-// EventLogger is a async event logger.
+func init() {
+	prometheus.MustRegister(elogWritten, elogDropped)
+}
+
+// EventLoggerParams holds the buffering parameters for the event
+// logger.
+type EventLoggerParams struct {
+	// Limit is the maximum number of bytes to buffer.
+	Limit int
+	// DropOldest discards the oldest entries on overflow instead
+	// of the new entry.
+	DropOldest bool
+}
+
+// defaultEventLoggerParams are used until the elog param is set.
+var defaultEventLoggerParams = EventLoggerParams{
+	Limit: 256 * 1024,
+}
+
+// logQueue is a byte bounded FIFO of pending log entries.
+type logQueue struct {
+	entries [][]byte
+	size    int
+}
+
+// push appends p, discarding entries as needed to stay within limit
+// bytes.  Returns the number of bytes dropped.
+func (q *logQueue) push(p []byte, limit int, dropOldest bool) int {
+	if len(p) > limit {
+		return len(p)
+	}
+
+	dropped := 0
+	for q.size+len(p) > limit {
+		if !dropOldest {
+			return len(p)
+		}
+		head := q.entries[0]
+		q.entries[0] = nil
+		q.entries = q.entries[1:]
+		q.size -= len(head)
+		dropped += len(head)
+	}
+
+	q.entries = append(q.entries, p)
+	q.size += len(p)
+	return dropped
+}
+
+// take removes and returns all pending entries.
+func (q *logQueue) take() [][]byte {
+	entries := q.entries
+	q.entries = nil
+	q.size = 0
+	return entries
+}
+
+// EventLogger is a async event logger.  Writes never block.  If the
+// sink falls behind then entries are dropped based on the policy in
+// the elog param.
 type EventLogger struct {
 	logger *log.Logger
 	sink   *os.File
 	zip    *gzip.Writer
-	msgs   chan []byte
+
+	mu      sync.Mutex
+	queue   logQueue
+	wake    chan bool
+	written int
+	dropped int
+
+	params       EventLoggerParamsParam
+	writtenParam *param.Param
+	droppedParam *param.Param
+	lastWritten  int
+	lastDropped  int
+	batch        bytes.Buffer
 }
 
 // NewEventLogger creates a new event logger that writes to the given
 // base name.
-func NewEventLogger(name string) *EventLogger {
+func NewEventLogger(name string, params *param.Params) *EventLogger {
 	now := time.Now().Format(time.RFC3339)
 	fname := fmt.Sprintf("%s-%s.txt.gz", name, now)
 	sink, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
@@ -43,13 +131,19 @@ func NewEventLogger(name string) *EventLogger {
 	}
 
 	zip := gzip.NewWriter(sink)
-
-	msgs := make(chan []byte, 10)
+	defaults := defaultEventLoggerParams
 
 	el := &EventLogger{
 		sink: sink,
 		zip:  zip,
-		msgs: msgs,
+		wake: make(chan bool, 1),
+		params: EventLoggerParamsParam{params.NewWith("elog", &defaults, &param.Meta{
+			Leaves: map[string]*param.Meta{
+				"limit": {Description: "Maximum queued bytes", Unit: "bytes", Min: 1024, Max: 64 * 1024 * 1024},
+			},
+		})},
+		writtenParam: params.NewNum("elog.written", &param.Meta{Unit: "bytes", ReadOnly: true}),
+		droppedParam: params.NewNum("elog.dropped", &param.Meta{Unit: "bytes", ReadOnly: true}),
 	}
 
 	el.logger = log.New(el, "", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
@@ -64,18 +158,76 @@ func (el *EventLogger) run() {
 
 	for {
 		select {
-		case p := <-el.msgs:
-			el.zip.Write(p)
+		case <-el.wake:
+			el.drain()
 		case <-tick:
+			el.drain()
 			el.zip.Flush()
-			break
+			el.export()
 		}
 	}
 }
 
+// drain writes all pending entries to the sink as one batch.
+func (el *EventLogger) drain() {
+	el.mu.Lock()
+	entries := el.queue.take()
+	el.mu.Unlock()
+
+	if len(entries) == 0 {
+		return
+	}
+
+	el.batch.Reset()
+	for _, entry := range entries {
+		el.batch.Write(entry)
+	}
+	n, _ := el.zip.Write(el.batch.Bytes())
+	elogWritten.Add(float64(n))
+
+	el.mu.Lock()
+	el.written += n
+	el.mu.Unlock()
+}
+
+// export updates the counter params.  Done periodically as the
+// updates are themselves logged.
+func (el *EventLogger) export() {
+	el.mu.Lock()
+	written, dropped := el.written, el.dropped
+	el.mu.Unlock()
+
+	if written != el.lastWritten {
+		el.lastWritten = written
+		el.writtenParam.SetInt(written)
+	}
+	if dropped != el.lastDropped {
+		el.lastDropped = dropped
+		el.droppedParam.SetInt(dropped)
+	}
+}
+
+// Write queues p to be written and returns immediately.
 func (el *EventLogger) Write(p []byte) (n int, err error) {
 	buf := make([]byte, len(p))
 	copy(buf, p)
-	el.msgs <- buf
+	params, ok := el.params.Value()
+	if !ok {
+		params = &defaultEventLoggerParams
+	}
+
+	el.mu.Lock()
+	dropped := el.queue.push(buf, params.Limit, params.DropOldest)
+	el.dropped += dropped
+	el.mu.Unlock()
+
+	if dropped != 0 {
+		elogDropped.Add(float64(dropped))
+	}
+
+	select {
+	case el.wake <- true:
+	default:
+	}
 	return len(p), nil
 }
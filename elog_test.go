@@ -0,0 +1,83 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"juju.nz/x/pipoint/param"
+)
+
+func TestLogQueueDropNewest(t *testing.T) {
+	q := &logQueue{}
+
+	assert.Equal(t, q.push([]byte("abcd"), 10, false), 0)
+	assert.Equal(t, q.push([]byte("efgh"), 10, false), 0)
+	// Doesn't fit so is dropped.
+	assert.Equal(t, q.push([]byte("ijkl"), 10, false), 4)
+	// Does fit.
+	assert.Equal(t, q.push([]byte("mn"), 10, false), 0)
+
+	entries := q.take()
+	assert.Equal(t, len(entries), 3)
+	assert.Equal(t, string(entries[0]), "abcd")
+	assert.Equal(t, string(entries[2]), "mn")
+
+	// Taking empties the queue.
+	assert.Equal(t, len(q.take()), 0)
+	assert.Equal(t, q.size, 0)
+}
+
+func TestLogQueueDropOldest(t *testing.T) {
+	q := &logQueue{}
+
+	q.push([]byte("abcd"), 10, true)
+	q.push([]byte("efgh"), 10, true)
+	// Pushes out the first entry.
+	assert.Equal(t, q.push([]byte("ijkl"), 10, true), 4)
+
+	entries := q.take()
+	assert.Equal(t, len(entries), 2)
+	assert.Equal(t, string(entries[0]), "efgh")
+	assert.Equal(t, string(entries[1]), "ijkl")
+}
+
+func TestLogQueueTooBig(t *testing.T) {
+	q := &logQueue{}
+
+	q.push([]byte("abcd"), 10, true)
+	// Larger than the whole buffer so is dropped, keeping the
+	// existing entries.
+	assert.Equal(t, q.push([]byte("0123456789abc"), 10, true), 13)
+	assert.Equal(t, len(q.take()), 1)
+}
+
+func TestEventLoggerBadParams(t *testing.T) {
+	ps := &param.Params{Name: "root"}
+	el := &EventLogger{
+		wake:   make(chan bool, 1),
+		params: EventLoggerParamsParam{ps.New("elog")},
+	}
+
+	// Set to the wrong type, such as over MQTT.  Falls back to the
+	// defaults.
+	el.params.Set("texty")
+	n, err := el.Write([]byte("abcd"))
+	assert.Nil(t, err)
+	assert.Equal(t, n, 4)
+	assert.Equal(t, len(el.queue.take()), 1)
+}
@@ -0,0 +1,215 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlLine struct {
+	AltitudeMode string `xml:"altitudeMode,omitempty"`
+	Coordinates  string `xml:"coordinates"`
+}
+
+type kmlPlacemark struct {
+	Name        string    `xml:"name"`
+	Description string    `xml:"description,omitempty"`
+	TimeStamp   string    `xml:"TimeStamp>when,omitempty"`
+	StyleURL    string    `xml:"styleUrl,omitempty"`
+	Point       *kmlPoint `xml:"Point"`
+	LineString  *kmlLine  `xml:"LineString"`
+}
+
+type kmlFolder struct {
+	Name       string          `xml:"name"`
+	Placemarks []*kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlStyle struct {
+	ID    string `xml:"id,attr"`
+	Color string `xml:"LineStyle>color"`
+	Width int    `xml:"LineStyle>width"`
+}
+
+type kmlDocument struct {
+	XMLName    xml.Name        `xml:"kml"`
+	Namespace  string          `xml:"xmlns,attr"`
+	Name       string          `xml:"Document>name"`
+	Styles     []*kmlStyle     `xml:"Document>Style"`
+	Placemarks []*kmlPlacemark `xml:"Document>Placemark"`
+	Folders    []*kmlFolder    `xml:"Document>Folder"`
+}
+
+// coordinates formats positions as KML lon,lat,alt tuples.
+func coordinates(positions ...*Position) string {
+	var buf bytes.Buffer
+	for i, p := range positions {
+		if i != 0 {
+			buf.WriteString(" ")
+		}
+		fmt.Fprintf(&buf, "%.7f,%.7f,%.1f", p.Lon, p.Lat, p.Alt)
+	}
+	return buf.String()
+}
+
+// WriteKML writes the track as KML for Google Earth.
+func (t *Track) WriteKML(w io.Writer, name string) error {
+	doc := &kmlDocument{
+		Namespace: "http://www.opengis.net/kml/2.2",
+		Name:      name,
+		Styles: []*kmlStyle{
+			{ID: "rover", Color: "ff0000ff", Width: 2},
+			{ID: "bearing", Color: "7f00ffff", Width: 1},
+		},
+	}
+
+	if len(t.Rover) != 0 {
+		var positions []*Position
+		for _, p := range t.Rover {
+			positions = append(positions, &p.Position)
+		}
+		doc.Placemarks = append(doc.Placemarks, &kmlPlacemark{
+			Name:     "Rover",
+			StyleURL: "#rover",
+			LineString: &kmlLine{
+				AltitudeMode: "absolute",
+				Coordinates:  coordinates(positions...),
+			},
+		})
+	}
+
+	if t.Base != nil {
+		doc.Placemarks = append(doc.Placemarks, &kmlPlacemark{
+			Name:  "Base",
+			Point: &kmlPoint{coordinates(t.Base)},
+		})
+
+		bearings := &kmlFolder{Name: "Bearings"}
+		for _, b := range t.Bearings {
+			end := project(t.Base, b.Yaw, b.Range)
+			bearings.Placemarks = append(bearings.Placemarks, &kmlPlacemark{
+				Name:      fmt.Sprintf("%.0f°", AsDeg(b.Yaw)),
+				TimeStamp: b.Stamp.Format(time.RFC3339),
+				StyleURL:  "#bearing",
+				LineString: &kmlLine{
+					AltitudeMode: "clampToGround",
+					Coordinates:  coordinates(t.Base, end),
+				},
+			})
+		}
+		doc.Folders = append(doc.Folders, bearings)
+	}
+
+	states := &kmlFolder{Name: "States"}
+	for _, s := range t.States {
+		at := s.At
+		if at == nil {
+			at = t.Base
+		}
+		if at == nil {
+			continue
+		}
+		states.Placemarks = append(states.Placemarks, &kmlPlacemark{
+			Name:        s.Name,
+			Description: s.Stamp.Format(time.RFC3339),
+			TimeStamp:   s.Stamp.Format(time.RFC3339),
+			Point:       &kmlPoint{coordinates(at)},
+		})
+	}
+	doc.Folders = append(doc.Folders, states)
+
+	return writeXML(w, doc)
+}
+
+type gpxPoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Ele  float64 `xml:"ele"`
+	Time string  `xml:"time,omitempty"`
+	Name string  `xml:"name,omitempty"`
+}
+
+type gpxDocument struct {
+	XMLName   xml.Name    `xml:"gpx"`
+	Namespace string      `xml:"xmlns,attr"`
+	Version   string      `xml:"version,attr"`
+	Creator   string      `xml:"creator,attr"`
+	Waypoints []*gpxPoint `xml:"wpt"`
+	Name      string      `xml:"trk>name"`
+	Points    []*gpxPoint `xml:"trk>trkseg>trkpt"`
+}
+
+// WriteGPX writes the rover track and the base as GPX.
+func (t *Track) WriteGPX(w io.Writer, name string) error {
+	doc := &gpxDocument{
+		Namespace: "http://www.topografix.com/GPX/1/1",
+		Version:   "1.1",
+		Creator:   "pipoint",
+		Name:      name,
+	}
+
+	if t.Base != nil {
+		doc.Waypoints = append(doc.Waypoints, &gpxPoint{
+			Lat:  t.Base.Lat,
+			Lon:  t.Base.Lon,
+			Ele:  t.Base.Alt,
+			Name: "Base",
+		})
+	}
+	for _, s := range t.States {
+		if s.At == nil {
+			continue
+		}
+		doc.Waypoints = append(doc.Waypoints, &gpxPoint{
+			Lat:  s.At.Lat,
+			Lon:  s.At.Lon,
+			Ele:  s.At.Alt,
+			Time: s.Stamp.UTC().Format(time.RFC3339),
+			Name: s.Name,
+		})
+	}
+	for _, p := range t.Rover {
+		doc.Points = append(doc.Points, &gpxPoint{
+			Lat:  p.Lat,
+			Lon:  p.Lon,
+			Ele:  p.Alt,
+			Time: p.Stamp.UTC().Format(time.RFC3339Nano),
+		})
+	}
+
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"juju.nz/x/pipoint/analyse"
+)
+
+func TestToPosition(t *testing.T) {
+	p := &Position{Lat: -36.85, Lon: 174.76, Alt: 20}
+	back := p.ToNEU().ToPosition()
+
+	assert.InDelta(t, back.Lat, p.Lat, 1e-9)
+	assert.InDelta(t, back.Lon, p.Lon, 1e-9)
+	assert.Equal(t, back.Alt, p.Alt)
+}
+
+func TestProject(t *testing.T) {
+	base := &Position{Lat: 46.8, Lon: 8.2}
+
+	east := project(base, math.Pi/2, 100)
+	assert.InDelta(t, distance(base, east), 100, 0.1)
+	assert.Equal(t, east.Lat, base.Lat)
+	assert.True(t, east.Lon > base.Lon)
+}
+
+const trackLog = `2017/10/22 10:00:00.000000 pipoint.go:230: state float64 0
+2017/10/22 10:00:01.000000 pipoint.go:230: gps *pipoint.Position &pipoint.Position{Time:1, Lat:46.8, Lon:8.2, Alt:500, Heading:0}
+2017/10/22 10:00:01.000000 pipoint.go:230: base.position *pipoint.NEUPosition &pipoint.NEUPosition{Time:1, North:5.202611184601062e+06, East:625982.3486816535, Up:500}
+2017/10/22 10:00:02.000000 pipoint.go:230: state float64 2
+2017/10/22 10:00:03.000000 pipoint.go:230: gps *pipoint.Position &pipoint.Position{Time:3, Lat:46.801, Lon:8.2, Alt:520, Heading:0}
+2017/10/22 10:00:03.000000 pipoint.go:230: pantilt.pan.sp float64 0.5
+2017/10/22 10:00:03.500000 pipoint.go:230: pantilt.pan.sp float64 0.6
+`
+
+func TestTrack(t *testing.T) {
+	events, err := analyse.Parse(strings.NewReader(trackLog))
+	assert.Nil(t, err)
+
+	track := NewTrack(events, time.Second)
+	assert.Equal(t, len(track.Rover), 2)
+	assert.InDelta(t, track.Base.Lat, 46.8, 1e-4)
+	// Second bearing is inside the interval.
+	assert.Equal(t, len(track.Bearings), 1)
+	assert.InDelta(t, track.Bearings[0].Range, 111, 1)
+	assert.Equal(t, len(track.States), 2)
+	assert.Equal(t, track.States[1].Name, "Run")
+
+	var buf bytes.Buffer
+	assert.Nil(t, track.WriteKML(&buf, "test"))
+	assert.Contains(t, buf.String(), "<coordinates>8.2000000,46.8000000,500.0 8.2000000,46.8010000,520.0</coordinates>")
+	assert.Contains(t, buf.String(), "<name>Run</name>")
+
+	buf.Reset()
+	assert.Nil(t, track.WriteGPX(&buf, "test"))
+	assert.Contains(t, buf.String(), `<trkpt lat="46.801" lon="8.2">`)
+}
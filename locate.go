@@ -29,17 +29,22 @@ func (s *LocateState) Name() string {
 	return "Locate"
 }
 
-// Update is called when a param is updated.
+// Update is called when a param is updated.  The base follows the
+// rover unless it was loaded from the config.
 func (s *LocateState) Update(param *param.Param) {
 	switch param {
-	case s.pi.neu:
+	case s.pi.neu.Param:
 		s.pi.rover.Set(param.Get())
-		s.pi.base.Set(param.Get())
-		s.pi.base.Finalise()
-	case s.pi.attitude:
-		s.pi.offset.Set(&Attitude{
-			Yaw: s.pi.attitude.Get().(*Attitude).Yaw,
-		})
+		if !s.pi.baseLoaded {
+			s.pi.base.Set(param.Get())
+			s.pi.base.Finalise()
+		}
+	case s.pi.attitude.Param:
+		if attitude, ok := s.pi.attitude.Value(); ok {
+			s.pi.offset.Set(&Attitude{
+				Yaw: attitude.Yaw,
+			})
+		}
 	case s.pi.mark:
 		s.pi.state.Inc()
 	}
@@ -0,0 +1,177 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"juju.nz/x/pipoint/util"
+)
+
+const (
+	logAlways = iota
+	logChange
+	logRate
+	logNever
+)
+
+// logPolicy is how often updates to a param should be logged.
+type logPolicy struct {
+	kind int
+	// hz is the maximum rate for logRate.
+	hz float64
+}
+
+// defaultLogPolicies drops the params that flood the log but aren't
+// needed for analysis.
+var defaultLogPolicies = map[string]interface{}{
+	"tick":            "never",
+	"pred":            "never",
+	"pantilt.pan.pv":  "change",
+	"pantilt.tilt.pv": "change",
+}
+
+// parseLogPolicy parses a policy such as "always", "change", "never",
+// or a maximum rate like "5hz".
+func parseLogPolicy(v interface{}) (logPolicy, error) {
+	switch v.(type) {
+	case int:
+		return parseLogPolicy(float64(v.(int)))
+	case float64:
+		hz := v.(float64)
+		if hz <= 0 {
+			return logPolicy{kind: logNever}, nil
+		}
+		return logPolicy{kind: logRate, hz: hz}, nil
+	case string:
+	default:
+		return logPolicy{}, fmt.Errorf("Unrecognised log policy %v", v)
+	}
+
+	text := strings.ToLower(strings.TrimSpace(v.(string)))
+	switch text {
+	case "always":
+		return logPolicy{kind: logAlways}, nil
+	case "change":
+		return logPolicy{kind: logChange}, nil
+	case "never":
+		return logPolicy{kind: logNever}, nil
+	}
+
+	hz, err := strconv.ParseFloat(strings.TrimSuffix(text, "hz"), 64)
+	if err != nil {
+		return logPolicy{}, fmt.Errorf("Unrecognised log policy %v", v)
+	}
+	return parseLogPolicy(hz)
+}
+
+// LogFilter decides which param updates are written to the event
+// log.  Policies apply to the named param and everything below it,
+// with the most specific name winning.
+type LogFilter struct {
+	mu       sync.Mutex
+	policies map[string]logPolicy
+	last     map[string]string
+	limiter  *util.Limiter
+}
+
+// NewLogFilter creates a new filter with the default policies.
+func NewLogFilter() *LogFilter {
+	f := &LogFilter{}
+	f.Configure(nil)
+	return f
+}
+
+// flatten converts a nested config map into dotted names.
+func flatten(prefix string, config map[string]interface{}, out map[string]interface{}) {
+	for name, v := range config {
+		name = strings.ToLower(prefix + name)
+		if child, ok := v.(map[string]interface{}); ok {
+			flatten(name+".", child, out)
+		} else {
+			out[name] = v
+		}
+	}
+}
+
+// Configure replaces the policies with the defaults plus the given
+// nested map of param name to policy.
+func (f *LogFilter) Configure(config map[string]interface{}) error {
+	merged := make(map[string]interface{})
+	flatten("", defaultLogPolicies, merged)
+	flatten("", config, merged)
+
+	policies := make(map[string]logPolicy)
+	var err error
+
+	for name, v := range merged {
+		policy, perr := parseLogPolicy(v)
+		if perr != nil {
+			err = fmt.Errorf("%v: %v", name, perr)
+			continue
+		}
+		policies[name] = policy
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.policies = policies
+	f.last = make(map[string]string)
+	f.limiter = util.NewLimiter()
+	return err
+}
+
+// policy returns the policy for the most specific match of name.
+func (f *LogFilter) policy(name string) logPolicy {
+	name = strings.ToLower(name)
+	for {
+		if policy, ok := f.policies[name]; ok {
+			return policy
+		}
+		dot := strings.LastIndex(name, ".")
+		if dot < 0 {
+			return logPolicy{kind: logAlways}
+		}
+		name = name[:dot]
+	}
+}
+
+// Check returns true if entry, the formatted value of the named
+// param, should be logged.
+func (f *LogFilter) Check(name string, entry string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	policy := f.policy(name)
+
+	switch policy.kind {
+	case logNever:
+		return false
+	case logChange:
+		if last, ok := f.last[name]; ok && last == entry {
+			return false
+		}
+		f.last[name] = entry
+		return true
+	case logRate:
+		return f.limiter.Ok(name, 1/policy.hz)
+	default:
+		return true
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"juju.nz/x/pipoint/util"
+)
+
+func TestParseLogPolicy(t *testing.T) {
+	p, err := parseLogPolicy("Never")
+	assert.Nil(t, err)
+	assert.Equal(t, p.kind, logNever)
+
+	p, err = parseLogPolicy("5hz")
+	assert.Nil(t, err)
+	assert.Equal(t, p, logPolicy{kind: logRate, hz: 5})
+
+	p, err = parseLogPolicy(2)
+	assert.Nil(t, err)
+	assert.Equal(t, p, logPolicy{kind: logRate, hz: 2})
+
+	_, err = parseLogPolicy("sometimes")
+	assert.Error(t, err)
+}
+
+func TestLogFilterDefaults(t *testing.T) {
+	f := NewLogFilter()
+
+	assert.False(t, f.Check("tick", "float64 1"))
+	assert.True(t, f.Check("gps.fix", "float64 3"))
+	assert.True(t, f.Check("gps.fix", "float64 3"))
+}
+
+func TestLogFilterNested(t *testing.T) {
+	f := NewLogFilter()
+	f.Configure(map[string]interface{}{
+		"rover": "never",
+		"rover.attitude": map[string]interface{}{
+			"yaw": "always",
+		},
+	})
+
+	// Applies to children.
+	assert.False(t, f.Check("rover.position", ""))
+	assert.True(t, f.Check("rover.attitude.yaw", ""))
+	// Defaults are kept.
+	assert.False(t, f.Check("tick", ""))
+}
+
+func TestLogFilterChange(t *testing.T) {
+	f := NewLogFilter()
+
+	assert.True(t, f.Check("pantilt.pan.pv", "float64 1.5"))
+	assert.False(t, f.Check("pantilt.pan.pv", "float64 1.5"))
+	assert.True(t, f.Check("pantilt.pan.pv", "float64 1.6"))
+}
+
+func TestLogFilterRate(t *testing.T) {
+	f := NewLogFilter()
+	f.Configure(map[string]interface{}{"gps": "2hz"})
+
+	util.OverrideNow(100)
+	assert.True(t, f.Check("gps", ""))
+	util.OverrideNow(100.2)
+	assert.False(t, f.Check("gps", ""))
+	util.OverrideNow(100.5)
+	assert.True(t, f.Check("gps", ""))
+}
@@ -32,13 +32,13 @@ func (s *OrientateState) Name() string {
 // Update is called when a param is updated.
 func (s *OrientateState) Update(param *param.Param) {
 	switch param {
-	case s.pi.neu:
+	case s.pi.neu.Param:
 		s.pi.rover.Set(param.Get())
 	case s.pi.mark:
 		s.pi.state.Inc()
 	}
 
-	if param != s.pi.rover {
+	if param != s.pi.rover.Param {
 		return
 	}
 
@@ -46,9 +46,13 @@ func (s *OrientateState) Update(param *param.Param) {
 		return
 	}
 
-	rover := s.pi.rover.Get().(*NEUPosition)
-	base := s.pi.base.Get().(*NEUPosition)
-	offset := s.pi.baseOffset.Get().(*NEUPosition)
+	rover, ok1 := s.pi.rover.Value()
+	base, ok2 := s.pi.base.Value()
+	offset, ok3 := s.pi.baseOffset.Value()
+	current, ok4 := s.pi.offset.Value()
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return
+	}
 
 	att, err := point(rover, base, offset)
 
@@ -56,7 +60,6 @@ func (s *OrientateState) Update(param *param.Param) {
 		return
 	}
 
-	current := s.pi.offset.Get().(*Attitude)
 	s.pi.offset.Set(&Attitude{
 		Yaw:   -att.Yaw,
 		Pitch: current.Pitch,
@@ -0,0 +1,118 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Describe implements prometheus.Collector.  Params and the keys of
+// maps come and go, so nothing is described and Params is an
+// unchecked collector.
+func (ps *Params) Describe(ch chan<- *prometheus.Desc) {
+}
+
+// Collect implements prometheus.Collector.  Each param is one metric
+// named after the param, such as pipoint_pantilt_pan, with a "leaf"
+// label holding the path of the leaf within a struct, slice, or map.
+// Numbers and bools are gauges, or counters if the metadata says so.
+// Strings are exported as a <name>_info metric with the string in the
+// "value" label.  <root>_param_ok and <root>_param_age_seconds show
+// the staleness of each param.
+func (ps *Params) Collect(ch chan<- prometheus.Metric) {
+	okDesc := prometheus.NewDesc(metricName(ps.Name+"_param_ok"),
+		"1 if the param has been recently updated.", []string{"param"}, nil)
+	ageDesc := prometheus.NewDesc(metricName(ps.Name+"_param_age_seconds"),
+		"Time since the param was last updated.", []string{"param"}, nil)
+
+	for _, p := range ps.All() {
+		name := metricName(makeName([]string{ps.Name, p.Name}))
+
+		ok := 0.0
+		if p.Ok() {
+			ok = 1
+		}
+		send(ch, okDesc, prometheus.GaugeValue, ok, p.Name)
+		if age, updated := p.Age(); updated {
+			send(ch, ageDesc, prometheus.GaugeValue, age.Seconds(), p.Name)
+		}
+
+		ps.collectOne(p, name, ch)
+	}
+}
+
+// collectOne sends the leaves of one param as the named metric.
+func (ps *Params) collectOne(p *Param, name string, ch chan<- prometheus.Metric) {
+	v := reflect.ValueOf(p.Get())
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	var labels []string
+	switch v.Kind() {
+	case reflect.Invalid:
+		return
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+		labels = []string{"leaf"}
+	}
+
+	help := p.meta.help()
+	if help == "" {
+		help = fmt.Sprintf("The %v param.", p.Name)
+	}
+	valueType := prometheus.GaugeValue
+	if p.meta != nil && p.meta.Counter {
+		valueType = prometheus.CounterValue
+	}
+
+	desc := prometheus.NewDesc(name, help, labels, nil)
+	info := prometheus.NewDesc(name+"_info", help, append(labels, "value"), nil)
+
+	ps.visitOne(p, func(_ *Param, leaf string, v reflect.Value) {
+		var values []string
+		if labels != nil {
+			values = append(values, leaf)
+		}
+
+		switch v.Kind() {
+		case reflect.Bool:
+			f := 0.0
+			if v.Bool() {
+				f = 1
+			}
+			send(ch, desc, valueType, f, values...)
+		case reflect.String:
+			if v.String() != "" {
+				send(ch, info, prometheus.GaugeValue, 1, append(values, v.String())...)
+			}
+		default:
+			if isNumberKind(v.Kind()) {
+				f := v.Convert(reflect.TypeOf(0.0)).Float()
+				send(ch, desc, valueType, f, values...)
+			}
+		}
+	}, nil, v, false)
+}
+
+// send sends a metric, dropping any that are invalid such as strings
+// that aren't UTF-8.
+func send(ch chan<- prometheus.Metric, desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labels ...string) {
+	if m, err := prometheus.NewConstMetric(desc, valueType, value, labels...); err == nil {
+		ch <- m
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Base is the last known state of one remote params tree, such as a
+// pipoint base station.
+type Base struct {
+	Device string
+	Online bool
+	// Values holds the last payload of each leaf by dotted name,
+	// such as "link.status", and the birth messages such as
+	// "$build_label".
+	Values map[string]string
+	// Meta holds the leaf metadata from the discovery document.
+	Meta map[string]*Meta
+}
+
+// Group returns the base's group param, or "" if none.
+func (b *Base) Group() string {
+	return b.Values["group"]
+}
+
+// Format returns the value of the leaf, using the enum name if the
+// metadata has one.
+func (b *Base) Format(name string) string {
+	value, ok := b.Values[name]
+	if !ok {
+		return "-"
+	}
+	if meta := b.Meta[name]; meta != nil && len(meta.Enum) != 0 {
+		if i, err := strconv.Atoi(value); err == nil && i >= 0 && i < len(meta.Enum) {
+			return meta.Enum[i]
+		}
+	}
+	return value
+}
+
+// waiter waits for a base to publish a leaf value.
+type waiter struct {
+	topic string
+	want  string
+	done  chan bool
+}
+
+// Controller watches every params tree with the same name on an MQTT
+// server, such as all pipoint bases, and sets params on all or some
+// of them.
+type Controller struct {
+	name    string
+	client  mqttClient
+	options MQTTOptions
+
+	mu      sync.Mutex
+	bases   map[string]*Base
+	waiters []*waiter
+}
+
+// NewController connects to the MQTT server and watches all trees
+// with the given name.
+func NewController(name string, options *MQTTOptions) (*Controller, error) {
+	c := newController(name, nil, options)
+	client, err := newPahoClient(&c.options, "", c.connected)
+	if err != nil {
+		return nil, err
+	}
+	c.client = client
+	client.connect()
+	return c, nil
+}
+
+func newController(name string, client mqttClient, options *MQTTOptions) *Controller {
+	return &Controller{
+		name:    name,
+		client:  client,
+		options: *options,
+		bases:   make(map[string]*Base),
+	}
+}
+
+// connected subscribes to all bases.
+func (c *Controller) connected() {
+	c.client.Subscribe("+/"+c.name+"/#", c.options.QoS, c.recv)
+}
+
+// recv records a value published by a base and completes any waiting
+// sets.
+func (c *Controller) recv(msg Message) {
+	parts := strings.Split(msg.Topic(), "/")
+	if len(parts) < 3 || parts[1] != c.name {
+		return
+	}
+	device := parts[0]
+	name := strings.Join(parts[2:], ".")
+	payload := string(msg.Payload())
+	if strings.HasSuffix(name, ".set") || strings.HasSuffix(name, ".get") {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := c.bases[device]
+	if b == nil {
+		b = &Base{
+			Device: device,
+			Values: make(map[string]string),
+			Meta:   make(map[string]*Meta),
+		}
+		c.bases[device] = b
+	}
+
+	switch name {
+	case "$status":
+		online := payload == statusOnline
+		if online != b.Online {
+			log.Printf("controller: %v is %v\n", device, payload)
+		}
+		b.Online = online
+	case "$meta":
+		var leaves []*discoveryLeaf
+		if err := json.Unmarshal(msg.Payload(), &leaves); err != nil {
+			log.Printf("controller: %v: %v\n", msg.Topic(), err)
+			return
+		}
+		prefix := device + "/" + c.name + "/"
+		for _, leaf := range leaves {
+			meta := leaf.Meta
+			rel := strings.TrimPrefix(leaf.Topic, prefix)
+			b.Meta[strings.Replace(rel, "/", ".", -1)] = &meta
+		}
+	default:
+		b.Values[name] = payload
+	}
+
+	var waiting []*waiter
+	for _, w := range c.waiters {
+		if w.topic == msg.Topic() && sameValue(w.want, payload) {
+			close(w.done)
+		} else {
+			waiting = append(waiting, w)
+		}
+	}
+	c.waiters = waiting
+}
+
+// sameValue returns true if the payloads are equal as numbers or
+// strings.
+func sameValue(a, b string) bool {
+	fa, erra := strconv.ParseFloat(a, 64)
+	fb, errb := strconv.ParseFloat(b, 64)
+	if erra == nil && errb == nil {
+		return fa == fb
+	}
+	return a == b
+}
+
+// Bases returns a copy of all known bases sorted by device.
+func (c *Controller) Bases() []*Base {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var bases []*Base
+	for _, b := range c.bases {
+		copied := *b
+		copied.Values = make(map[string]string)
+		for k, v := range b.Values {
+			copied.Values[k] = v
+		}
+		copied.Meta = make(map[string]*Meta)
+		for k, v := range b.Meta {
+			copied.Meta[k] = v
+		}
+		bases = append(bases, &copied)
+	}
+	sort.Sort(byDevice(bases))
+	return bases
+}
+
+type byDevice []*Base
+
+func (b byDevice) Len() int           { return len(b) }
+func (b byDevice) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byDevice) Less(i, j int) bool { return b[i].Device < b[j].Device }
+
+// match returns the online bases in target, which is "all", a group,
+// or a device.
+func (c *Controller) match(target string) []*Base {
+	var bases []*Base
+	for _, b := range c.Bases() {
+		if !b.Online {
+			continue
+		}
+		if target == "" || target == "all" || b.Group() == target || b.Device == target {
+			bases = append(bases, b)
+		}
+	}
+	return bases
+}
+
+// Set writes value to the named leaf, such as "state" or
+// "rover.target", on every base in target.  Enum names are converted
+// to the base's index.  Each base is acknowledged once it publishes
+// the new value.  Returns the error, or nil if acknowledged, for each
+// device.
+func (c *Controller) Set(target, name, value string, timeout time.Duration) (map[string]error, error) {
+	bases := c.match(target)
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("No online bases in %v", target)
+	}
+
+	results := make(map[string]error)
+	waiters := make(map[string]*waiter)
+	for _, b := range bases {
+		want, err := b.encode(name, value)
+		if err != nil {
+			results[b.Device] = err
+			continue
+		}
+		topic := strings.Join([]string{b.Device, c.name, strings.Replace(name, ".", "/", -1)}, "/")
+		w := &waiter{topic: topic, want: want, done: make(chan bool)}
+		c.mu.Lock()
+		c.waiters = append(c.waiters, w)
+		c.mu.Unlock()
+
+		waiters[b.Device] = w
+		c.client.Publish(topic+"/set", c.options.QoS, false, []byte(want))
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	expired := false
+	mine := make(map[*waiter]bool)
+	for device, w := range waiters {
+		mine[w] = true
+		if !expired {
+			select {
+			case <-w.done:
+				results[device] = nil
+				continue
+			case <-timer.C:
+				expired = true
+			}
+		}
+		select {
+		case <-w.done:
+			results[device] = nil
+		default:
+			results[device] = errors.New("No ack")
+		}
+	}
+
+	c.mu.Lock()
+	var waiting []*waiter
+	for _, w := range c.waiters {
+		if !mine[w] {
+			waiting = append(waiting, w)
+		}
+	}
+	c.waiters = waiting
+	c.mu.Unlock()
+	return results, nil
+}
+
+// encode converts an enum name into the base's index.
+func (b *Base) encode(name, value string) (string, error) {
+	meta := b.Meta[name]
+	if meta == nil || len(meta.Enum) == 0 {
+		return value, nil
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value, nil
+	}
+	for i, e := range meta.Enum {
+		if strings.EqualFold(e, value) {
+			return strconv.Itoa(i), nil
+		}
+	}
+	return "", fmt.Errorf("%q is not one of %v", value, meta.Enum)
+}
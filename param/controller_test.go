@@ -0,0 +1,103 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestController(t *testing.T) {
+	client := newTestClient()
+	c := newController("pipoint", client, &MQTTOptions{})
+	c.connected()
+	recv := client.handlers["+/pipoint/#"]
+	assert.NotNil(t, recv)
+
+	meta := `[{"Topic": "a/pipoint/state", "Type": "float64", "Enum": ["Locate", "Run"]}]`
+	for _, m := range []*testMessage{
+		{"a/pipoint/$status", "online"},
+		{"a/pipoint/$meta", meta},
+		{"a/pipoint/state", "0"},
+		{"a/pipoint/group", "east"},
+		{"b/pipoint/$status", "online"},
+		{"b/pipoint/state", "1"},
+		{"c/pipoint/$status", "offline"},
+		{"c/other/$status", "online"},
+	} {
+		recv(m)
+	}
+
+	bases := c.Bases()
+	assert.Equal(t, len(bases), 3)
+	assert.Equal(t, bases[0].Device, "a")
+	assert.Equal(t, bases[0].Format("state"), "Locate")
+	assert.Equal(t, bases[0].Group(), "east")
+	assert.Equal(t, bases[1].Format("state"), "1")
+	assert.Equal(t, bases[1].Format("gps.fix"), "-")
+	assert.False(t, bases[2].Online)
+
+	// Base a acknowledges by publishing the new value.  b doesn't.
+	client.onPublish = func(topic string, payload []byte) {
+		if strings.HasPrefix(topic, "a/") && strings.HasSuffix(topic, "/set") {
+			go recv(&testMessage{strings.TrimSuffix(topic, "/set"), string(payload)})
+		}
+	}
+
+	results, err := c.Set("all", "state", "run", 50*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, client.published["a/pipoint/state/set"].payload, "1")
+	assert.Nil(t, results["a"])
+	assert.NotNil(t, results["b"])
+	assert.Nil(t, c.waiters)
+
+	// Only the east group.
+	results, err = c.Set("east", "mark", "1", 50*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, len(results), 1)
+	assert.Nil(t, results["a"])
+
+	_, err = c.Set("west", "mark", "1", time.Millisecond)
+	assert.NotNil(t, err)
+}
+
+func TestControllerMetaConcurrent(t *testing.T) {
+	client := newTestClient()
+	c := newController("pipoint", client, &MQTTOptions{})
+	c.connected()
+	recv := client.handlers["+/pipoint/#"]
+	recv(&testMessage{"a/pipoint/$status", "online"})
+
+	// Metadata arrives while the bases are being shown.
+	done := make(chan bool)
+	go func() {
+		meta := `[{"Topic": "a/pipoint/state", "Type": "float64", "Enum": ["Locate", "Run"]}]`
+		for i := 0; i < 100; i++ {
+			recv(&testMessage{"a/pipoint/$meta", meta})
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		for _, b := range c.Bases() {
+			b.Format("state")
+			b.encode("state", "run")
+		}
+	}
+	<-done
+}
@@ -0,0 +1,118 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Sample is the value of a param at a time.
+type Sample struct {
+	Time  time.Time
+	Value interface{}
+}
+
+// history is a ring buffer of the most recent samples.
+type history struct {
+	samples []Sample
+	next    int
+	full    bool
+}
+
+func newHistory(size int) *history {
+	return &history{samples: make([]Sample, size)}
+}
+
+func (h *history) add(s Sample) {
+	h.samples[h.next] = s
+	h.next++
+	if h.next == len(h.samples) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+// all returns the samples oldest first.
+func (h *history) all() []Sample {
+	if !h.full {
+		return append([]Sample(nil), h.samples[:h.next]...)
+	}
+	all := append([]Sample(nil), h.samples[h.next:]...)
+	return append(all, h.samples[:h.next]...)
+}
+
+// Record keeps the last size values of this param.  Zero stops
+// recording.  Existing samples are kept where they fit.
+func (p *Param) Record(size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if size <= 0 {
+		p.history = nil
+		return
+	}
+	if p.history != nil && len(p.history.samples) == size {
+		return
+	}
+
+	next := newHistory(size)
+	if p.history != nil {
+		for _, s := range p.history.all() {
+			next.add(s)
+		}
+	}
+	p.history = next
+}
+
+// History returns the recorded values from the last since, oldest
+// first.  Zero returns all.  Returns nil if the param isn't recorded.
+func (p *Param) History(since time.Duration) []Sample {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.history == nil {
+		return nil
+	}
+	all := p.history.all()
+	if since <= 0 {
+		return all
+	}
+	start := time.Now().Add(-since)
+	for i, s := range all {
+		if !s.Time.Before(start) {
+			return all[i:]
+		}
+	}
+	return all[:0]
+}
+
+// asDuration converts a number of seconds or a duration string like
+// "500ms" to a duration.
+func asDuration(value interface{}) (time.Duration, error) {
+	if s, ok := value.(string); ok {
+		if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+			return time.Duration(seconds * float64(time.Second)), nil
+		}
+		return time.ParseDuration(s)
+	}
+	seconds, err := asNumber(value)
+	if err != nil {
+		return 0, fmt.Errorf("%v is not a duration", value)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory(t *testing.T) {
+	ps := &Params{Name: "root"}
+	p := ps.NewNum("foo", &Meta{History: 3})
+	other := ps.NewNum("bar")
+
+	for i := 1; i <= 4; i++ {
+		p.SetFloat64(float64(i))
+		other.SetFloat64(float64(i))
+	}
+	assert.Nil(t, other.History(0))
+
+	// Only the newest three are kept, oldest first.
+	all := p.History(0)
+	assert.Equal(t, len(all), 3)
+	assert.Equal(t, all[0].Value, 2.0)
+	assert.Equal(t, all[2].Value, 4.0)
+
+	time.Sleep(20 * time.Millisecond)
+	p.SetFloat64(5)
+	recent := p.History(10 * time.Millisecond)
+	assert.Equal(t, len(recent), 1)
+	assert.Equal(t, recent[0].Value, 5.0)
+
+	// Growing keeps the existing samples.
+	p.Record(10)
+	assert.Equal(t, len(p.History(0)), 3)
+	p.Record(0)
+	assert.Nil(t, p.History(0))
+}
+
+func TestHistoryAPI(t *testing.T) {
+	ps := &Params{Name: "root"}
+	p := ps.NewNum("foo.bar", &Meta{History: 10})
+	ps.NewNum("baz")
+	p.SetFloat64(1)
+	p.SetFloat64(2)
+
+	w := request(ps, "GET", "/foo/bar?history=30s", "")
+	assert.Equal(t, w.Code, http.StatusOK)
+	var samples []Sample
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &samples))
+	assert.Equal(t, len(samples), 2)
+	assert.Equal(t, samples[1].Value, 2.0)
+
+	w = request(ps, "GET", "/baz?history=30s", "")
+	assert.Equal(t, w.Code, http.StatusNotFound)
+
+	w = request(ps, "GET", "/foo/bar?history=soon", "")
+	assert.Equal(t, w.Code, http.StatusBadRequest)
+}
+
+func TestHistoryConfig(t *testing.T) {
+	ps := &Params{Name: "root", viper: viper.New()}
+	p := ps.NewNum("foo.bar")
+
+	ps.viper.Set("root.history", map[string]interface{}{
+		"foo": map[string]interface{}{"bar": 5},
+	})
+	ps.Load()
+
+	p.SetFloat64(1)
+	assert.Equal(t, len(p.History(0)), 1)
+}
+
+func TestHistoryConfigDotted(t *testing.T) {
+	ps := &Params{Name: "root", viper: viper.New()}
+	pan := ps.NewNum("pantilt.pan")
+	sp := ps.NewNum("pantilt.pan.sp")
+	pv := ps.NewNum("pantilt.pan.pv")
+
+	ps.viper.SetConfigType("yaml")
+	err := ps.viper.ReadConfig(strings.NewReader(`
+root:
+  history:
+    pantilt.pan: 5
+    pantilt.pan.sp: 10
+    pantilt.nope: 10
+    pantilt:
+      pan:
+        pv: 10
+`))
+	assert.Nil(t, err)
+	ps.Load()
+
+	for _, p := range []*Param{pan, sp, pv} {
+		p.SetFloat64(1)
+		assert.Equal(t, len(p.History(0)), 1, p.Name)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// haUnsafe matches the characters not allowed in a Home Assistant
+// object ID.
+var haUnsafe = regexp.MustCompile("[^a-zA-Z0-9_-]+")
+
+// haDevice groups the entities under one device.
+type haDevice struct {
+	Identifiers []string `json:"identifiers"`
+	Name        string   `json:"name"`
+	SWVersion   string   `json:"sw_version,omitempty"`
+}
+
+// haConfig is a Home Assistant MQTT discovery config.
+type haConfig struct {
+	Name                string    `json:"name"`
+	UniqueID            string    `json:"unique_id"`
+	StateTopic          string    `json:"state_topic,omitempty"`
+	CommandTopic        string    `json:"command_topic,omitempty"`
+	AvailabilityTopic   string    `json:"availability_topic"`
+	PayloadAvailable    string    `json:"payload_available"`
+	PayloadNotAvailable string    `json:"payload_not_available"`
+	Unit                string    `json:"unit_of_measurement,omitempty"`
+	ValueTemplate       string    `json:"value_template,omitempty"`
+	CommandTemplate     string    `json:"command_template,omitempty"`
+	Options             []string  `json:"options,omitempty"`
+	Min                 *float64  `json:"min,omitempty"`
+	Max                 *float64  `json:"max,omitempty"`
+	Step                float64   `json:"step,omitempty"`
+	Mode                string    `json:"mode,omitempty"`
+	PayloadOn           string    `json:"payload_on,omitempty"`
+	PayloadOff          string    `json:"payload_off,omitempty"`
+	PayloadPress        string    `json:"payload_press,omitempty"`
+	Device              *haDevice `json:"device"`
+}
+
+// haEntity is one discovery config and the component it's for.
+type haEntity struct {
+	component string
+	objectID  string
+	config    *haConfig
+}
+
+// haEntities builds the Home Assistant entities for the params.
+// Leaves are included if their metadata has a description, unit, or
+// enum, or the param is an action.  Read only leaves are sensors.
+// Writable leaves are selects if they have an enum, buttons if the
+// param is an action, and numbers or text otherwise.
+func (b *ParamMQTTBridge) haEntities() []*haEntity {
+	device := &haDevice{
+		Identifiers: []string{b.prefix},
+		Name:        b.prefix,
+		SWVersion:   b.options.BuildLabel,
+	}
+	root := makeName([]string{b.params.Name}) + "."
+
+	var entities []*haEntity
+	b.params.WalkLeaves(func(p *Param, name string, v reflect.Value) {
+		path := b.params.leafPath(p, name)
+		meta := p.meta.leaf(path)
+		action := p.meta != nil && p.meta.Action
+		if !v.IsValid() || !action && (meta == nil || meta.Description == "" && meta.Unit == "" && len(meta.Enum) == 0) {
+			return
+		}
+		if meta == nil {
+			meta = &Meta{}
+		}
+		readOnly := meta.ReadOnly || p.meta.ReadOnly
+
+		rel := strings.TrimPrefix(name, root)
+		topic := b.prefix + "/" + strings.Replace(rel, ".", "/", -1)
+		objectID := haUnsafe.ReplaceAllString(strings.Replace(rel, ".", "_", -1), "_")
+
+		config := &haConfig{
+			Name:                meta.Description,
+			UniqueID:            haUnsafe.ReplaceAllString(b.prefix, "_") + "_" + objectID,
+			StateTopic:          topic,
+			AvailabilityTopic:   b.prefix + "/$status",
+			PayloadAvailable:    statusOnline,
+			PayloadNotAvailable: statusOffline,
+			Unit:                meta.Unit,
+			Device:              device,
+		}
+		if config.Name == "" {
+			config.Name = rel
+		}
+		if len(meta.Enum) != 0 {
+			names, _ := json.Marshal(meta.Enum)
+			config.ValueTemplate = "{{ " + string(names) + "[value | int] }}"
+		}
+
+		component := "sensor"
+		switch {
+		case v.Kind() == reflect.Bool:
+			component = "binary_sensor"
+			config.PayloadOn = "true"
+			config.PayloadOff = "false"
+		case readOnly:
+		case action:
+			component = "button"
+			config.StateTopic = ""
+			config.CommandTopic = topic + "/set"
+			config.PayloadPress = "1"
+		case len(meta.Enum) != 0:
+			names, _ := json.Marshal(meta.Enum)
+			component = "select"
+			config.CommandTopic = topic + "/set"
+			config.CommandTemplate = "{{ " + string(names) + ".index(value) }}"
+			config.Options = meta.Enum
+		case v.Kind() == reflect.String:
+			component = "text"
+			config.CommandTopic = topic + "/set"
+		case isNumberKind(v.Kind()):
+			component = "number"
+			config.CommandTopic = topic + "/set"
+			config.Mode = "box"
+			min, max := -1e6, 1e6
+			if meta.Max > meta.Min {
+				min, max = meta.Min, meta.Max
+			}
+			config.Min, config.Max = &min, &max
+			config.Step = 0.001
+			if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+				config.Step = 1
+			}
+		default:
+			return
+		}
+
+		entities = append(entities, &haEntity{component, objectID, config})
+	})
+	return entities
+}
+
+// publishHomeAssistant publishes the retained discovery configs under
+// the Home Assistant discovery prefix.
+func (b *ParamMQTTBridge) publishHomeAssistant() {
+	node := haUnsafe.ReplaceAllString(b.options.Device, "_")
+	for _, e := range b.haEntities() {
+		data, err := json.Marshal(e.config)
+		if err != nil {
+			continue
+		}
+		topic := strings.Join([]string{b.options.HomeAssistant, e.component, node, e.objectID, "config"}, "/")
+		b.client.Publish(topic, b.options.QoS, true, data)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Meta describes a param or one of its leaves.  The limits are only
+// checked on external writes such as from MQTT or HTTP.
+type Meta struct {
+	Description string `json:",omitempty"`
+	Unit        string `json:",omitempty"`
+	// Min and Max bound numbers if Max is greater than Min.
+	Min float64 `json:",omitempty"`
+	Max float64 `json:",omitempty"`
+	// Enum names the allowed values.  Numbers are an index into
+	// Enum and strings must match an entry.
+	Enum     []string `json:",omitempty"`
+	ReadOnly bool     `json:",omitempty"`
+	// Action marks a param that does something whenever it is
+	// written, such as mark.
+	Action bool `json:",omitempty"`
+	// Retain asks the MQTT server to keep the last value for new
+	// clients.  Persistent params are always retained.
+	Retain bool `json:",omitempty"`
+	// Counter marks a number that only goes up, such as a count of
+	// messages.  Other numbers are exported as gauges.
+	Counter bool `json:",omitempty"`
+	// MaxAge is how long the param stays valid after an update.
+	// Zero means DefaultMaxAge.
+	MaxAge time.Duration `json:",omitempty"`
+	// History is the number of values to record.  See
+	// Param.Record.
+	History int `json:",omitempty"`
+	// Leaves describes the leaves of a struct value by their
+	// dotted path, such as "max" or "limits.low".  A "*" matches
+	// any index or key, such as "presets.*.yaw".
+	Leaves map[string]*Meta `json:",omitempty"`
+}
+
+func firstMeta(metas []*Meta) *Meta {
+	if len(metas) == 0 {
+		return nil
+	}
+	return metas[0]
+}
+
+// leaf returns the metadata for the leaf at path, or nil.
+func (m *Meta) leaf(path []string) *Meta {
+	if m == nil {
+		return nil
+	}
+	if len(path) == 0 {
+		return m
+	}
+	for key, leaf := range m.Leaves {
+		if matchPath(strings.Split(key, "."), path) {
+			return leaf
+		}
+	}
+	return nil
+}
+
+// matchPath returns true if path matches pattern in any case, where
+// "*" matches any one element.
+func matchPath(pattern, path []string) bool {
+	if len(pattern) != len(path) {
+		return false
+	}
+	for i, name := range pattern {
+		if name != "*" && !strings.EqualFold(name, path[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// check returns an error if value is outside of the limits.
+func (m *Meta) check(value interface{}) error {
+	if m == nil {
+		return nil
+	}
+	if m.ReadOnly {
+		return fmt.Errorf("Is read only")
+	}
+
+	if s, ok := value.(string); ok {
+		if len(m.Enum) == 0 {
+			return nil
+		}
+		for _, e := range m.Enum {
+			if e == s {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of %v", s, m.Enum)
+	}
+
+	v := reflect.ValueOf(value)
+	var f float64
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f = v.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f = float64(v.Uint())
+	default:
+		return nil
+	}
+
+	if m.Max > m.Min && (f < m.Min || f > m.Max) {
+		return fmt.Errorf("%v is outside of %v to %v", f, m.Min, m.Max)
+	}
+	if len(m.Enum) != 0 && (f != math.Floor(f) || f < 0 || int(f) >= len(m.Enum)) {
+		return fmt.Errorf("%v is not an index into %v", f, m.Enum)
+	}
+	return nil
+}
+
+// help returns the description and unit as a single line.
+func (m *Meta) help() string {
+	if m == nil {
+		return ""
+	}
+	help := m.Description
+	if m.Unit != "" {
+		help = strings.TrimSpace(fmt.Sprintf("%s (%s)", help, m.Unit))
+	}
+	return help
+}
+
+// Meta returns the metadata for this param, or nil if none.
+func (p *Param) Meta() *Meta {
+	return p.meta
+}
+
+// Check returns an error if an external write of value would break
+// the param metadata.
+func (p *Param) Check(value interface{}) error {
+	if p.meta == nil {
+		return nil
+	}
+	if p.meta.ReadOnly {
+		return fmt.Errorf("%v is read only", p.Name)
+	}
+	if value == nil {
+		return nil
+	}
+
+	var err error
+	p.walk(func(_ *Param, path []string, leaf interface{}) {
+		if err == nil {
+			err = p.CheckLeaf(path[1:], leaf)
+		}
+	}, []string{p.Name}, reflect.ValueOf(value))
+	return err
+}
+
+// CheckLeaf returns an error if an external write of value to the
+// leaf at path would break the metadata.
+func (p *Param) CheckLeaf(path []string, value interface{}) error {
+	if p.meta == nil {
+		return nil
+	}
+	if p.meta.ReadOnly {
+		return fmt.Errorf("%v is read only", p.Name)
+	}
+	if len(path) == 0 {
+		if err := p.meta.check(value); err != nil {
+			return fmt.Errorf("%v: %v", p.Name, err)
+		}
+		return nil
+	}
+	if err := p.meta.leaf(path).check(value); err != nil {
+		return fmt.Errorf("%v.%v: %v", p.Name, strings.Join(path, "."), err)
+	}
+	return nil
+}
+
+// SetExternal checks the value against the metadata and then sets
+// it.  Use for writes from outside such as MQTT or HTTP.
+func (p *Param) SetExternal(value interface{}) error {
+	if err := p.Check(value); err != nil {
+		return err
+	}
+	return p.Set(value)
+}
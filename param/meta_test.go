@@ -0,0 +1,113 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetaCheck(t *testing.T) {
+	ps := &Params{Name: "root"}
+	num := ps.NewNum("num", &Meta{Min: -1, Max: 1})
+	state := ps.NewNum("state", &Meta{Enum: []string{"a", "b"}})
+	mode := ps.NewWith("mode", "fast", &Meta{Enum: []string{"fast", "slow"}})
+	fixed := ps.NewNum("fixed", &Meta{ReadOnly: true})
+	plain := ps.NewNum("plain")
+
+	assert.Nil(t, num.SetExternal(0.5))
+	assert.NotNil(t, num.SetExternal(1.5))
+	assert.Equal(t, num.GetFloat64(), 0.5)
+
+	assert.Nil(t, state.SetExternal(1))
+	assert.NotNil(t, state.SetExternal(2))
+	assert.NotNil(t, state.SetExternal(0.5))
+
+	assert.Nil(t, mode.SetExternal("slow"))
+	assert.NotNil(t, mode.SetExternal("medium"))
+
+	assert.NotNil(t, fixed.SetExternal(1))
+	// Internal writes aren't checked.
+	assert.Nil(t, fixed.Set(1))
+	assert.Nil(t, num.Set(5))
+
+	assert.Nil(t, plain.SetExternal(1e6))
+}
+
+func TestMetaLeaves(t *testing.T) {
+	ps := &Params{Name: "root"}
+	blob := ps.NewWith("blob", &TestParamStructT{1, 2, 3}, &Meta{
+		Leaves: map[string]*Meta{
+			"b": {Min: 0, Max: 10, Unit: "m"},
+			"c": {ReadOnly: true},
+		},
+	})
+
+	assert.Nil(t, blob.CheckLeaf([]string{"B"}, 5.0))
+	assert.NotNil(t, blob.CheckLeaf([]string{"b"}, 11.0))
+	assert.NotNil(t, blob.CheckLeaf([]string{"c"}, 3.0))
+	assert.Nil(t, blob.CheckLeaf([]string{"a"}, 100.0))
+
+	// A whole value is checked leaf by leaf.
+	assert.NotNil(t, blob.Check(&TestParamStructT{1, 20, 3}))
+
+	// As is the HTTP API.
+	w := request(ps, "PUT", "/blob/b", "20")
+	assert.Equal(t, w.Code, http.StatusBadRequest)
+	w = request(ps, "PUT", "/blob/b", "7")
+	assert.Equal(t, w.Code, http.StatusOK)
+}
+
+func TestMetaMetrics(t *testing.T) {
+	ps := &Params{Name: "root"}
+	ps.NewWith("speed", 3.0, &Meta{Description: "Rover speed", Unit: "m/s"})
+	ps.NewWith("plain", 4.0)
+
+	w := httptest.NewRecorder()
+	ps.Metrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	assert.Contains(t, body, "# HELP root_speed Rover speed (m/s)\n# TYPE root_speed gauge\nroot_speed 3\n")
+	assert.Contains(t, body, "# HELP root_plain The plain param.\n# TYPE root_plain gauge\nroot_plain 4\n")
+}
+
+func TestMetaDiscovery(t *testing.T) {
+	ps := &Params{Name: "root"}
+	ps.NewWith("pan.speed", 3.0, &Meta{Unit: "m/s", Max: 10})
+	ps.NewWith("blob", &TestParamStructT{1, 2, 3}, &Meta{
+		ReadOnly: true,
+		Leaves:   map[string]*Meta{"b": {Unit: "m"}},
+	})
+
+	doc, err := ps.discovery("host/root")
+	assert.Nil(t, err)
+
+	var leaves []map[string]interface{}
+	assert.Nil(t, json.Unmarshal(doc, &leaves))
+	assert.Equal(t, len(leaves), 4)
+	assert.Equal(t, leaves[0]["Topic"], "host/root/pan/speed")
+	assert.Equal(t, leaves[0]["Type"], "float64")
+	assert.Equal(t, leaves[0]["Unit"], "m/s")
+	assert.Equal(t, leaves[0]["Max"], 10.0)
+	assert.Nil(t, leaves[0]["ReadOnly"])
+	assert.Equal(t, leaves[2]["Topic"], "host/root/blob/b")
+	assert.Equal(t, leaves[2]["Unit"], "m")
+	assert.Equal(t, leaves[2]["ReadOnly"], true)
+}
@@ -19,39 +19,152 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// DefaultMaxAge is how long a param stays valid after an update if
+// no other age is given.
+const DefaultMaxAge = 3 * time.Second
+
 // Param is a value or a struct that has age and validity.  Updating a
 // Param also fires an event.
+//
+// A Param is safe for concurrent use.  Values are shared between
+// goroutines and must be treated as immutable: don't modify a struct
+// returned by Get or passed to Set.  Use SetLeaf to change one field
+// of a copy instead.
 type Param struct {
-	Name    string
+	Name   string
+	params *Params
+	meta   *Meta
+
+	mu      sync.Mutex
 	value   interface{}
 	updated time.Time
-	params  *Params
 	final   bool
+	persist bool
+	maxAge  time.Duration
+	// valid is the validity last reported to the OnValidity
+	// hooks.
+	valid   bool
+	timer   *time.Timer
+	history *history
 }
 
 // Ok return true if the value has been recently updated.
 func (p *Param) Ok() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ok()
+}
+
+// ok is Ok with mu held.
+func (p *Param) ok() bool {
 	if p.final {
 		return true
 	}
-	elapsed := time.Now().Sub(p.updated)
-	return elapsed.Seconds() < 3
+	if p.updated.IsZero() {
+		return false
+	}
+	return time.Now().Sub(p.updated) < p.getMaxAge()
+}
+
+// getMaxAge returns the max age with mu held.
+func (p *Param) getMaxAge() time.Duration {
+	if p.maxAge > 0 {
+		return p.maxAge
+	}
+	if p.meta != nil && p.meta.MaxAge > 0 {
+		return p.meta.MaxAge
+	}
+	return DefaultMaxAge
+}
+
+// MaxAge returns how long the param stays valid after an update.
+func (p *Param) MaxAge() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.getMaxAge()
+}
+
+// SetMaxAge changes how long the param stays valid after an update.
+// Zero reverts to the default.
+func (p *Param) SetMaxAge(maxAge time.Duration) {
+	p.mu.Lock()
+	p.maxAge = maxAge
+	changed, ok := p.checkValid()
+	p.mu.Unlock()
+
+	p.notifyValid(changed, ok)
+}
+
+// Age returns the time since the last update, and false if never
+// updated.
+func (p *Param) Age() (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.updated.IsZero() {
+		return 0, false
+	}
+	return time.Now().Sub(p.updated), true
+}
+
+// checkValid updates the reported validity and arms the timer that
+// checks for going stale.  Returns true if the validity changed and
+// the new validity.  Call with mu held.
+func (p *Param) checkValid() (bool, bool) {
+	ok := p.ok()
+	if ok && !p.final {
+		remaining := p.getMaxAge() - time.Now().Sub(p.updated)
+		if p.timer == nil {
+			p.timer = time.AfterFunc(remaining, p.expire)
+		} else {
+			p.timer.Reset(remaining)
+		}
+	}
+	if ok == p.valid {
+		return false, ok
+	}
+	p.valid = ok
+	return true, ok
+}
+
+// expire is called by the timer when the param may have gone stale.
+func (p *Param) expire() {
+	p.mu.Lock()
+	changed, ok := p.checkValid()
+	p.mu.Unlock()
+
+	p.notifyValid(changed, ok)
+}
+
+// notifyValid tells the hooks if the validity changed.
+func (p *Param) notifyValid(changed, ok bool) {
+	if changed {
+		p.params.notifyValidity(p, ok)
+	}
 }
 
 // Get returns the current value which may be nil.
 func (p *Param) Get() interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	return p.value
 }
 
-// GetFloat64 returns the current value as a float64.
+// GetFloat64 returns the current value as a float64, or zero if not a
+// number.
 func (p *Param) GetFloat64() float64 {
-	return p.value.(float64)
+	f, _ := asNumber(p.Get())
+	return f
 }
 
-// GetInt returns the current value as an int.
+// GetInt returns the current value as an int, or zero if not a
+// number.
 func (p *Param) GetInt() int {
 	return int(p.GetFloat64())
 }
@@ -76,15 +189,28 @@ func isNumber(value interface{}) bool {
 	return err == nil
 }
 
-// Set the value, update validity, and notify listeners.
-func (p *Param) Set(value interface{}) error {
-	if p.value == nil {
-		// OK, nothing set yet.
-	} else if isNumber(p.value) && isNumber(value) {
-		// Number -> number is fine.
-	} else if reflect.TypeOf(value) != reflect.TypeOf(p.value) {
-		return fmt.Errorf("Type of %v changed from %v to %v",
-			p.Name, p.value, value)
+// modifier returns the next value given the current one, and false
+// if the value is unchanged.
+type modifier func(current interface{}) (interface{}, bool, error)
+
+// modify atomically replaces the value and then notifies listeners if
+// it changed.
+func (p *Param) modify(next modifier) (bool, error) {
+	p.mu.Lock()
+	value, changed, err := next(p.value)
+	if err == nil && changed {
+		if p.value == nil {
+			// OK, nothing set yet.
+		} else if isNumber(p.value) && isNumber(value) {
+			// Number -> number is fine.
+		} else if reflect.TypeOf(value) != reflect.TypeOf(p.value) {
+			err = fmt.Errorf("Type of %v changed from %v to %v",
+				p.Name, p.value, value)
+		}
+	}
+	if err != nil || !changed {
+		p.mu.Unlock()
+		return false, err
 	}
 
 	if isNumber(value) {
@@ -94,22 +220,52 @@ func (p *Param) Set(value interface{}) error {
 	p.value = value
 	p.updated = time.Now()
 	p.final = false
+	if p.history != nil {
+		p.history.add(Sample{p.updated, value})
+	}
+	changed, ok := p.checkValid()
+	p.mu.Unlock()
+
 	p.params.updated(p)
-	return nil
+	p.notifyValid(changed, ok)
+	return true, nil
+}
+
+// Set the value, update validity, and notify listeners.
+func (p *Param) Set(value interface{}) error {
+	_, err := p.modify(func(current interface{}) (interface{}, bool, error) {
+		return value, true, nil
+	})
+	return err
 }
 
 // Update tries to update the value.
 func (p *Param) Update(value interface{}) (bool, error) {
-	// Currently only handles numbers.
-	if isNumber(value) && isNumber(p.value) {
-		right, _ := asNumber(value)
-		left, _ := asNumber(p.value)
+	return p.modify(func(current interface{}) (interface{}, bool, error) {
+		// Currently only handles numbers.
+		if isNumber(value) && isNumber(current) {
+			right, _ := asNumber(value)
+			left, _ := asNumber(current)
 
-		if left == right {
-			return false, nil
+			if left == right {
+				return nil, false, nil
+			}
 		}
-	}
-	return true, p.Set(value)
+		return value, true, nil
+	})
+}
+
+// SetLeaf sets the leaf at path, such as ["Max"], on a copy of the
+// current value.  Numbers are converted to the type of the leaf.
+func (p *Param) SetLeaf(path []string, value interface{}) error {
+	_, err := p.modify(func(current interface{}) (interface{}, bool, error) {
+		next, err := withLeaf(reflect.ValueOf(current), path, value)
+		if err != nil {
+			return nil, false, fmt.Errorf("%v: %v", p.Name, err)
+		}
+		return next.Interface(), true, nil
+	})
+	return err
 }
 
 // SetFloat64 tries to update the value as a float64.
@@ -124,25 +280,184 @@ func (p *Param) SetInt(value int) error {
 
 // UpdateInt tries to update the value as an int.
 func (p *Param) UpdateInt(value int) (bool, error) {
-	if p.GetInt() == value {
-		return false, nil
-	}
-	return true, p.Set(value)
+	return p.Update(value)
+}
+
+// add atomically adds delta to the number value.
+func (p *Param) add(delta float64) error {
+	_, err := p.modify(func(current interface{}) (interface{}, bool, error) {
+		f, err := asNumber(current)
+		if err != nil {
+			return nil, false, fmt.Errorf("%v: %v", p.Name, err)
+		}
+		return float64(int(f)) + delta, true, nil
+	})
+	return err
 }
 
 // Inc tries to increment the integer value.
 func (p *Param) Inc() error {
-	return p.SetInt(p.GetInt() + 1)
+	return p.add(1)
 }
 
 // Dec tries to decrement the integer value.
 func (p *Param) Dec() error {
-	return p.SetInt(p.GetInt() - 1)
+	return p.add(-1)
 }
 
 // Finalise marks the param as always valid.
 func (p *Param) Finalise() {
+	p.mu.Lock()
 	p.final = true
+	changed, ok := p.checkValid()
+	p.mu.Unlock()
+
+	p.notifyValid(changed, ok)
+}
+
+// Persist marks the param to be written back to the config by
+// Params.Save.
+func (p *Param) Persist() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.persist = true
+}
+
+// persistent returns true if the param should be saved and has been
+// set or loaded.
+func (p *Param) persistent() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.persist && (p.final || !p.updated.IsZero())
+}
+
+// withLeaf returns a copy of v with the leaf at path set to value.
+// Pointers along the path are copied so that v is unchanged.
+func withLeaf(v reflect.Value, path []string, value interface{}) (reflect.Value, error) {
+	switch v.Kind() {
+	case reflect.Invalid:
+		if len(path) != 0 {
+			return v, errors.New("Is nil")
+		}
+		return reflect.ValueOf(value), nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v, errors.New("Is nil")
+		}
+		inner, err := withLeaf(v.Elem(), path, value)
+		if err != nil {
+			return v, err
+		}
+		next := reflect.New(v.Type().Elem())
+		next.Elem().Set(inner)
+		return next, nil
+	case reflect.Interface:
+		return withLeaf(v.Elem(), path, value)
+	case reflect.Struct:
+		if len(path) == 0 {
+			return v, errors.New("Can't set a struct from a leaf")
+		}
+		next := reflect.New(v.Type()).Elem()
+		next.Set(v)
+		field := fieldByName(next, path[0])
+		if !field.IsValid() || !field.CanSet() {
+			return v, fmt.Errorf("No field %v in %v", path[0], v.Type())
+		}
+		inner, err := withLeaf(field, path[1:], value)
+		if err != nil {
+			return v, err
+		}
+		field.Set(inner)
+		return next, nil
+	case reflect.Slice, reflect.Array:
+		if len(path) == 0 {
+			return convert(value, v.Type())
+		}
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= v.Len() {
+			return v, fmt.Errorf("No index %v in %v", path[0], v.Type())
+		}
+		var next reflect.Value
+		if v.Kind() == reflect.Slice {
+			next = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+			reflect.Copy(next, v)
+		} else {
+			next = reflect.New(v.Type()).Elem()
+			next.Set(v)
+		}
+		inner, err := withLeaf(next.Index(i), path[1:], value)
+		if err != nil {
+			return v, err
+		}
+		next.Index(i).Set(inner)
+		return next, nil
+	case reflect.Map:
+		if len(path) == 0 {
+			return convert(value, v.Type())
+		}
+		key, ok := mapKey(v, path[0])
+		if !ok {
+			return v, fmt.Errorf("No key %v in %v", path[0], v.Type())
+		}
+		inner, err := withLeaf(v.MapIndex(key), path[1:], value)
+		if err != nil {
+			return v, err
+		}
+		next := reflect.MakeMap(v.Type())
+		for _, k := range v.MapKeys() {
+			next.SetMapIndex(k, v.MapIndex(k))
+		}
+		next.SetMapIndex(key, inner)
+		return next, nil
+	default:
+		if len(path) != 0 {
+			return v, fmt.Errorf("No field %v in %v", path[0], v.Type())
+		}
+		return convert(value, v.Type())
+	}
+}
+
+// mapKey returns the key of the map matching name in any case.
+func mapKey(v reflect.Value, name string) (reflect.Value, bool) {
+	for _, key := range v.MapKeys() {
+		if strings.EqualFold(fmt.Sprint(key.Interface()), name) {
+			return key, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// convert returns value as type t, converting between number types.
+func convert(value interface{}, t reflect.Type) (reflect.Value, error) {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return v, errors.New("Is nil")
+	}
+	if v.Type().AssignableTo(t) {
+		return v, nil
+	}
+	if isNumberKind(v.Kind()) && isNumberKind(t.Kind()) {
+		return v.Convert(t), nil
+	}
+	return v, fmt.Errorf("Can't set %v to %v", t, value)
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// fieldByName returns the struct field matching name in any case.
+func fieldByName(v reflect.Value, name string) reflect.Value {
+	return v.FieldByNameFunc(func(field string) bool {
+		return strings.EqualFold(field, name)
+	})
 }
 
 // ValueVisitor is a callback for leaves in the parameter tree.
@@ -150,16 +465,63 @@ type ValueVisitor func(p *Param, path []string, value interface{})
 
 func (p *Param) walk(visitor ValueVisitor, path []string, v reflect.Value) {
 	switch v.Kind() {
+	case reflect.Invalid:
+		// Unset or a nil pointer.
 	case reflect.Ptr, reflect.Interface:
 		p.walk(visitor, path, v.Elem())
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+		names, values := elems(v)
+		for i, name := range names {
+			p.walk(visitor, append(path, name), values[i])
+		}
+	default:
+		visitor(p, path, v.Interface())
+	}
+}
+
+// isContainer returns true if values of this kind are indexed by
+// number or key.
+func isContainer(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	default:
+		return false
+	}
+}
+
+// elems returns the names and values of the fields of a struct, the
+// indexes and elements of a slice or array, or the keys and elements
+// of a map sorted by key.
+func elems(v reflect.Value) ([]string, []reflect.Value) {
+	var names []string
+	var values []reflect.Value
+
+	switch v.Kind() {
 	case reflect.Struct:
 		t := v.Type()
 		for i := 0; i < v.NumField(); i++ {
-			p.walk(visitor, append(path, t.Field(i).Name), v.Field(i))
+			names = append(names, t.Field(i).Name)
+			values = append(values, v.Field(i))
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			names = append(names, strconv.Itoa(i))
+			values = append(values, v.Index(i))
+		}
+	case reflect.Map:
+		keys := make(map[string]reflect.Value)
+		for _, key := range v.MapKeys() {
+			name := fmt.Sprint(key.Interface())
+			names = append(names, name)
+			keys[name] = key
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			values = append(values, v.MapIndex(keys[name]))
 		}
-	default:
-		visitor(p, path, v.Interface())
 	}
+	return names, values
 }
 
 // Walk calls visitor on all leaf values of this parameter.
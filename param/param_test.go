@@ -16,8 +16,13 @@
 package param
 
 import (
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -42,15 +47,18 @@ func TestParamListen(t *testing.T) {
 	var val *Param
 
 	ch := make(ParamChannel, 10)
-	ps.Listen(ch)
+	sub := ps.Listen(ch)
 
 	p.SetFloat64(17)
 
+	val = <-ch
+	hits++
+
+	sub.Unsubscribe()
 	close(ch)
 
-	for p := range ch {
+	for range ch {
 		hits++
-		val = p
 	}
 
 	assert.Equal(t, val, p)
@@ -93,3 +101,195 @@ func TestParamNumber(t *testing.T) {
 	// Setting to a non-number causes an error.
 	assert.Error(t, p.Set(&TestParamStructT{}))
 }
+
+func TestParamSetLeaf(t *testing.T) {
+	ps := Params{}
+	before := &TestParamStructT{1, 2, 3}
+	p := ps.NewWith("blob", before)
+
+	// Numbers are converted to the leaf type.
+	assert.Nil(t, p.SetLeaf([]string{"b"}, 5.0))
+	assert.Equal(t, p.Get().(*TestParamStructT).B, 5)
+
+	// The original value is unchanged.
+	assert.Equal(t, before.B, 2)
+
+	assert.Error(t, p.SetLeaf([]string{"d"}, 1.0))
+	assert.Error(t, p.SetLeaf([]string{"c"}, "texty"))
+	assert.Error(t, p.SetLeaf(nil, 1.0))
+}
+
+func TestParamConcurrent(t *testing.T) {
+	ps := &Params{Name: "root", viper: viper.New()}
+	ps.viper.Set("root.blob.c", 7.5)
+	num := ps.NewNum("num")
+	blob := ps.NewWith("blob", &TestParamStructT{1, 2, 3})
+
+	sub := ps.Subscribe(nil)
+	done := make(chan bool)
+	go func() {
+		for range sub.C {
+		}
+		done <- true
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				num.Inc()
+				blob.SetLeaf([]string{"a"}, j)
+				ps.Load()
+				ps.WalkLeaves(func(p *Param, name string, v reflect.Value) {
+					v.Interface()
+				})
+				num.Ok()
+			}
+		}()
+	}
+	wg.Wait()
+	sub.Unsubscribe()
+	<-done
+
+	assert.Equal(t, num.GetInt(), 400)
+	assert.Equal(t, blob.Get().(*TestParamStructT).C, 7.5)
+}
+
+func TestParamMaxAge(t *testing.T) {
+	ps := &Params{Name: "root", viper: viper.New()}
+	fast := ps.NewNum("fast", &Meta{MaxAge: 20 * time.Millisecond})
+	slow := ps.NewNum("rover.slow")
+
+	assert.Equal(t, fast.MaxAge(), 20*time.Millisecond)
+	assert.Equal(t, slow.MaxAge(), DefaultMaxAge)
+
+	_, ok := fast.Age()
+	assert.False(t, ok)
+
+	ps.viper.Set("root.maxage", map[string]interface{}{
+		"rover": map[string]interface{}{"slow": "500ms"},
+	})
+	ps.Load()
+	assert.Equal(t, slow.MaxAge(), 500*time.Millisecond)
+
+	fast.SetFloat64(1)
+	age, ok := fast.Age()
+	assert.True(t, ok)
+	assert.True(t, age < fast.MaxAge())
+	assert.True(t, fast.Ok())
+
+	time.Sleep(30 * time.Millisecond)
+	assert.False(t, fast.Ok())
+}
+
+func TestParamMaxAgeDotted(t *testing.T) {
+	ps := &Params{Name: "root", viper: viper.New()}
+	gps := ps.NewNum("gps")
+	fix := ps.NewNum("gps.fix")
+	slow := ps.NewNum("rover.slow")
+
+	ps.viper.SetConfigType("yaml")
+	err := ps.viper.ReadConfig(strings.NewReader(`
+root:
+  maxage:
+    gps: 3s
+    gps.fix: 5s
+    alt: 1s
+    rover:
+      slow: bad
+`))
+	assert.Nil(t, err)
+	ps.Load()
+
+	// Unknown names and bad values are skipped.
+	assert.Equal(t, 3*time.Second, gps.MaxAge())
+	assert.Equal(t, 5*time.Second, fix.MaxAge())
+	assert.Equal(t, DefaultMaxAge, slow.MaxAge())
+}
+
+func TestParamValidity(t *testing.T) {
+	ps := &Params{Name: "root"}
+	p := ps.NewNum("foo", &Meta{MaxAge: 20 * time.Millisecond})
+
+	events := make(chan bool, 10)
+	ps.OnValidity(func(changed *Param, ok bool) {
+		if changed == p {
+			events <- ok
+		}
+	})
+
+	// Valid on the first set, but not again while valid.
+	p.SetFloat64(1)
+	p.SetFloat64(2)
+	assert.True(t, <-events)
+
+	// Goes stale after the max age.
+	assert.False(t, <-events)
+
+	p.SetFloat64(3)
+	assert.True(t, <-events)
+
+	// Finalised params never go stale.
+	p.Finalise()
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, p.Ok())
+	assert.Equal(t, len(events), 0)
+}
+
+type testPreset struct {
+	Yaw   float64
+	Pitch float64
+}
+
+type testPresets struct {
+	Presets []*testPreset
+	Rovers  map[string]int
+}
+
+func TestParamContainers(t *testing.T) {
+	ps := &Params{Name: "root", viper: viper.New()}
+	p := ps.NewWith("pantilt", &testPresets{
+		Presets: []*testPreset{{1, 2}, {3, 4}},
+		Rovers:  map[string]int{"b": 2, "a": 1},
+	}, &Meta{Leaves: map[string]*Meta{"presets.*.yaw": {Unit: "deg"}}})
+	before := p.Get().(*testPresets)
+
+	var names []string
+	ps.WalkLeaves(func(_ *Param, name string, _ reflect.Value) {
+		names = append(names, name)
+	})
+	assert.Equal(t, names, []string{
+		"root.pantilt.presets.0.yaw", "root.pantilt.presets.0.pitch",
+		"root.pantilt.presets.1.yaw", "root.pantilt.presets.1.pitch",
+		"root.pantilt.rovers.a", "root.pantilt.rovers.b",
+	})
+	assert.Equal(t, p.Meta().leaf([]string{"presets", "1", "yaw"}).Unit, "deg")
+	assert.Equal(t, metricName("root.rovers.my-rover"), "root_rovers_my_rover")
+
+	assert.Nil(t, p.SetLeaf([]string{"presets", "1", "yaw"}, 5))
+	assert.Nil(t, p.SetLeaf([]string{"rovers", "A"}, 7.0))
+	assert.NotNil(t, p.SetLeaf([]string{"presets", "2", "yaw"}, 5))
+	assert.NotNil(t, p.SetLeaf([]string{"rovers", "c"}, 5))
+
+	after := p.Get().(*testPresets)
+	assert.Equal(t, after.Presets[1].Yaw, 5.0)
+	assert.Equal(t, after.Rovers["a"], 7)
+	// The old value is unchanged.
+	assert.Equal(t, before.Presets[1].Yaw, 3.0)
+	assert.Equal(t, before.Rovers["a"], 1)
+
+	// The config replaces slices and merges maps.
+	ps.viper.Set("root.pantilt.presets", []interface{}{
+		map[interface{}]interface{}{"yaw": 10},
+		map[interface{}]interface{}{"pitch": 20},
+		map[interface{}]interface{}{"yaw": 30, "pitch": 40},
+	})
+	ps.viper.Set("root.pantilt.rovers", map[string]interface{}{"c": 3})
+	ps.Load()
+
+	loaded := p.Get().(*testPresets)
+	assert.Equal(t, loaded.Presets, []*testPreset{{10, 2}, {5, 20}, {30, 40}})
+	assert.Equal(t, loaded.Rovers, map[string]int{"a": 7, "b": 2, "c": 3})
+}
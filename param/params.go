@@ -16,27 +16,47 @@
 package param
 
 import (
-	"bytes"
 	"fmt"
+	"log"
 	"net/http"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
 )
 
 // ParamChannel passes changes to a Param.
 type ParamChannel chan *Param
 
+// LoadHook is called after the params have been loaded from config.
+type LoadHook func(ps *Params)
+
+// ValidityHook is called when a param becomes valid or goes stale.
+type ValidityHook func(p *Param, ok bool)
+
 // Params is a group of parameters that can be listened to.
+//
+// Params is safe for concurrent use.  Params can be added, set, and
+// listened to from any goroutine.  Listeners are notified after the
+// change is made and without holding any locks, so a slow listener
+// never blocks a Set.  Loads from the config are serialised.
 type Params struct {
-	Name      string
-	viper     *viper.Viper
+	Name  string
+	viper *viper.Viper
+
+	mu        sync.Mutex
 	params    []*Param
-	listeners []ParamChannel
+	listeners []*Subscription
+	hooks     []LoadHook
+	validity  []ValidityHook
+
+	loading sync.Mutex
 }
 
 // NewParams creates a new group of parameters with the given root name.
@@ -56,59 +76,103 @@ func NewParams(name string) *Params {
 }
 
 // New creates a new Param in this group.  The Param is uninitialised
-// and invalid.
-func (ps *Params) New(name string) *Param {
-	p := &Param{
-		Name:   name,
-		params: ps,
-	}
-	ps.params = append(ps.params, p)
+// and invalid.  Optionally takes metadata describing the param.
+func (ps *Params) New(name string, meta ...*Meta) *Param {
+	p := newParam(ps, name, meta)
+	ps.add(p)
 	return p
 }
 
 // NewNum create a new number param in this group.  The Param is zero
 // and invalid.
-func (ps *Params) NewNum(name string) *Param {
-	p := &Param{
-		Name:   name,
-		value:  0.0,
-		params: ps,
-	}
-	ps.params = append(ps.params, p)
+func (ps *Params) NewNum(name string, meta ...*Meta) *Param {
+	p := newParam(ps, name, meta)
+	p.value = 0.0
+	ps.add(p)
+	return p
+}
+
+// NewTyped creates a new param in this group that holds values of
+// the same type as zero.  The Param is zero and invalid.
+func (ps *Params) NewTyped(name string, zero interface{}, meta ...*Meta) *Param {
+	p := newParam(ps, name, meta)
+	p.value = zero
+	ps.add(p)
 	return p
 }
 
 // NewWith create a new, valid Param in this group using the given
 // value.
-func (ps *Params) NewWith(name string, value interface{}) *Param {
+func (ps *Params) NewWith(name string, value interface{}, meta ...*Meta) *Param {
+	p := newParam(ps, name, meta)
+	p.Set(value)
+	ps.add(p)
+	return p
+}
+
+func newParam(ps *Params, name string, metas []*Meta) *Param {
 	p := &Param{
 		Name:   name,
 		params: ps,
+		meta:   firstMeta(metas),
+	}
+	if p.meta != nil && p.meta.History > 0 {
+		p.history = newHistory(p.meta.History)
 	}
-	p.Set(value)
-	ps.params = append(ps.params, p)
 	return p
 }
 
+// add adds a new param.  Params are looked up by name in any case, so
+// a second param with the same name is a programming error.
+func (ps *Params) add(p *Param) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for _, existing := range ps.params {
+		if strings.EqualFold(existing.Name, p.Name) {
+			log.Panicf("Duplicate param %v\n", p.Name)
+		}
+	}
+	ps.params = append(ps.params, p)
+}
+
 func (ps *Params) updated(p *Param) {
-	for _, l := range ps.listeners {
-		l <- p
+	ps.mu.Lock()
+	listeners := ps.listeners
+	ps.mu.Unlock()
+
+	for _, l := range listeners {
+		l.push(p)
 	}
 }
 
-// Listen to changes on any parameter in this group.
-func (ps *Params) Listen(l ParamChannel) {
-	ps.listeners = append(ps.listeners, l)
+// All returns all params in this group.
+func (ps *Params) All() []*Param {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	all := make([]*Param, len(ps.params))
+	copy(all, ps.params)
+	return all
 }
 
 // LeafVisitor is called on every param value.
 type LeafVisitor func(p *Param, name string, value reflect.Value)
 
-// WalkLeaves calls the given visitor on every leaf value.
+// WalkLeaves calls the given visitor on every leaf value.  Elements
+// of slices and arrays are named by index, such as
+// "pantilt.presets.2.yaw", and elements of maps by key.
 func (ps *Params) WalkLeaves(visitor LeafVisitor) {
-	for _, p := range ps.params {
-		ps.visitOne(p, visitor, []string{ps.Name, p.Name}, reflect.ValueOf(p.Get()))
+	for _, p := range ps.All() {
+		ps.visitOne(p, visitor, []string{ps.Name, p.Name}, reflect.ValueOf(p.Get()), false)
+	}
+}
+
+// leafPath returns the path of the named leaf within the param.
+func (ps *Params) leafPath(p *Param, name string) []string {
+	rest := strings.TrimPrefix(name, makeName([]string{ps.Name, p.Name}))
+	if rest == "" {
+		return nil
 	}
+	return strings.Split(strings.TrimPrefix(rest, "."), ".")
 }
 
 func makeName(path []string) string {
@@ -116,79 +180,371 @@ func makeName(path []string) string {
 	return strings.ToLower(name)
 }
 
-func (ps *Params) visitOne(p *Param, visitor LeafVisitor, path []string, v reflect.Value) {
+// visitOne calls visitor on the leaves of v.  If whole is set then
+// slices, arrays, and maps are visited as one leaf.
+func (ps *Params) visitOne(p *Param, visitor LeafVisitor, path []string, v reflect.Value, whole bool) {
 	switch v.Kind() {
 	case reflect.Ptr, reflect.Interface:
-		ps.visitOne(p, visitor, path, v.Elem())
+		ps.visitOne(p, visitor, path, v.Elem(), whole)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if whole {
+			visitor(p, makeName(path), v)
+			return
+		}
+		fallthrough
 	case reflect.Struct:
-		t := v.Type()
-		for i := 0; i < v.NumField(); i++ {
-			ps.visitOne(p, visitor, append(path, t.Field(i).Name), v.Field(i))
+		names, values := elems(v)
+		for i, name := range names {
+			ps.visitOne(p, visitor, append(path, name), values[i], whole)
 		}
 	default:
 		visitor(p, makeName(path), v)
 	}
 }
 
-func format(name string, v reflect.Value) string {
-	switch v.Kind() {
-	case reflect.Invalid:
-		return ""
-	case reflect.String:
-		if v.String() != "" {
-			return fmt.Sprintf("%s{value=\"%s\"} 1", name, v)
-		}
-		return ""
-	case reflect.Float64, reflect.Float32:
-		vf := v.Float()
-		if float64(int(vf)) == vf {
-			return fmt.Sprintf("%s %v", name, int(vf))
-		}
-		return fmt.Sprintf("%s %v", name, v)
-	default:
-		return fmt.Sprintf("%s %v", name, v)
-	}
+// metricName replaces the characters that aren't allowed in a metric
+// name, such as from map keys.
+func metricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == ':':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
 }
 
-// Metrics generates Prometheus/Borgmon compatible metrics from all
-// params.
+// Metrics serves the params and the default Prometheus registry in
+// the Prometheus exposition format.
 func (ps *Params) Metrics(w http.ResponseWriter, req *http.Request) {
-	var buf bytes.Buffer
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(ps); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, reg}
+	promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+	}).ServeHTTP(w, req)
+}
+
+// Load fetches the supplied values from Viper and updates all
+// matching params.  Persistent params that are loaded are valid until
+// next set.
+func (ps *Params) Load() {
+	ps.loading.Lock()
+	defer ps.loading.Unlock()
 
-	ps.WalkLeaves(func(p *Param, name string, v reflect.Value) {
-		name = strings.Replace(name, ".", "_", -1)
-		f := format(name, v)
-		if f != "" {
-			buf.WriteString(f + "\n")
+	for _, p := range ps.All() {
+		if err := ps.loadOne(p); err != nil {
+			log.Printf("load: %v\n", err)
 		}
+	}
+	if err := ps.loadSection("maxage", loadMaxAge); err != nil {
+		log.Printf("load: %v\n", err)
+	}
+	if err := ps.loadSection("history", loadHistory); err != nil {
+		log.Printf("load: %v\n", err)
+	}
+
+	ps.mu.Lock()
+	hooks := ps.hooks
+	ps.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(ps)
+	}
+}
+
+// loadOne updates all leaves of one param from the config.  Slices
+// and maps are loaded as a whole so that the config can add or remove
+// elements.
+func (ps *Params) loadOne(p *Param) error {
+	var paths [][]string
+	var values []interface{}
+	var err error
+
+	ps.visitOne(p, func(_ *Param, name string, v reflect.Value) {
+		if err != nil || !ps.viper.IsSet(name) {
+			return
+		}
+		value := ps.viper.Get(name)
+		if isContainer(v.Kind()) {
+			var next reflect.Value
+			if next, err = fromConfig(value, v); err != nil {
+				err = fmt.Errorf("%v: %v", name, err)
+				return
+			}
+			value = next.Interface()
+		}
+		paths = append(paths, ps.leafPath(p, name))
+		values = append(values, value)
+	}, []string{ps.Name, p.Name}, reflect.ValueOf(p.Get()), true)
+
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	_, err = p.modify(func(current interface{}) (interface{}, bool, error) {
+		next := reflect.ValueOf(current)
+		for i, path := range paths {
+			var err error
+			if next, err = withLeaf(next, path, values[i]); err != nil {
+				return nil, false, fmt.Errorf("%v: %v", p.Name, err)
+			}
+		}
+		changed := !reflect.DeepEqual(current, next.Interface())
+		return next.Interface(), changed, nil
 	})
+	if err != nil {
+		return err
+	}
 
-	enc := expfmt.NewEncoder(&buf, expfmt.FmtText)
-	mfs, err := prometheus.DefaultGatherer.Gather()
+	p.mu.Lock()
+	persist := p.persist
+	p.mu.Unlock()
 
-	if err == nil {
-		for _, mf := range mfs {
-			enc.Encode(mf)
+	if persist {
+		p.Finalise()
+	}
+	return nil
+}
+
+// OnLoad adds a hook that is called every time the config is loaded.
+func (ps *Params) OnLoad(hook LoadHook) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.hooks = append(ps.hooks, hook)
+}
+
+// loadSection calls apply for each param named in the given section
+// of the config.  Names may be nested or dotted, such as gps: {fix: 5}
+// or gps.fix: 5.  Unknown names and bad values are logged and
+// skipped.
+func (ps *Params) loadSection(section string, apply func(p *Param, value interface{}) error) error {
+	var raw map[string]interface{}
+	if err := ps.Unmarshal(section, &raw); err != nil {
+		return err
+	}
+
+	flat := flatten("", raw)
+	var names []string
+	for name := range flat {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p := ps.find(name)
+		if p == nil {
+			log.Printf("load: %v: No param %v\n", section, name)
+			continue
+		}
+		if err := apply(p, flat[name]); err != nil {
+			log.Printf("load: %v: %v: %v\n", section, name, err)
 		}
 	}
+	return nil
+}
+
+// loadMaxAge sets the max age from the maxage section of the config.
+// Ages are in seconds or a duration like "500ms".
+func loadMaxAge(p *Param, value interface{}) error {
+	maxAge, err := asDuration(value)
+	if err != nil {
+		return err
+	}
+	p.SetMaxAge(maxAge)
+	return nil
+}
 
-	header := w.Header()
-	header.Set("Content-Type", string(expfmt.FmtText))
-	w.Write(buf.Bytes())
+// loadHistory sets the number of values to record from the history
+// section of the config.
+func loadHistory(p *Param, value interface{}) error {
+	size, err := asNumber(value)
+	if err != nil {
+		return err
+	}
+	p.Record(int(size))
+	return nil
 }
 
-// Load fetches the supplied values from Viper and updates all
-// matching params.
-func (ps *Params) Load() {
-	ps.WalkLeaves(func(p *Param, name string, v reflect.Value) {
-		if !ps.viper.IsSet(name) {
-			return
+// flatten converts nested maps into dotted names.
+func flatten(prefix string, raw map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+	for key, value := range raw {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
 		}
-		next := ps.viper.Get(name)
-		if v.CanSet() {
-			v.Set(reflect.ValueOf(next))
+		if child, ok := value.(map[string]interface{}); ok {
+			for k, v := range flatten(name, child) {
+				flat[k] = v
+			}
 		} else {
-			p.Update(next)
+			flat[name] = value
 		}
-	})
+	}
+	return flat
+}
+
+// fromConfig converts a value decoded from the config to the type of
+// like.  Struct fields and existing elements that aren't in the config
+// keep their value in like.
+func fromConfig(raw interface{}, like reflect.Value) (reflect.Value, error) {
+	t := like.Type()
+
+	switch like.Kind() {
+	case reflect.Ptr:
+		elem := reflect.Zero(t.Elem())
+		if !like.IsNil() {
+			elem = like.Elem()
+		}
+		inner, err := fromConfig(raw, elem)
+		if err != nil {
+			return like, err
+		}
+		next := reflect.New(t.Elem())
+		next.Elem().Set(inner)
+		return next, nil
+	case reflect.Interface:
+		if like.IsNil() {
+			return reflect.ValueOf(raw), nil
+		}
+		return fromConfig(raw, like.Elem())
+	case reflect.Struct:
+		fields, ok := toMap(raw)
+		if !ok {
+			return like, fmt.Errorf("Can't set %v to %v", t, raw)
+		}
+		next := reflect.New(t).Elem()
+		next.Set(like)
+		for key, value := range fields {
+			field := fieldByName(next, key)
+			if !field.IsValid() || !field.CanSet() {
+				return like, fmt.Errorf("No field %v in %v", key, t)
+			}
+			inner, err := fromConfig(value, field)
+			if err != nil {
+				return like, err
+			}
+			field.Set(inner)
+		}
+		return next, nil
+	case reflect.Slice, reflect.Array:
+		items, ok := raw.([]interface{})
+		if !ok {
+			return like, fmt.Errorf("Can't set %v to %v", t, raw)
+		}
+		var next reflect.Value
+		if like.Kind() == reflect.Slice {
+			next = reflect.MakeSlice(t, len(items), len(items))
+		} else if len(items) > like.Len() {
+			return like, fmt.Errorf("Too many elements for %v", t)
+		} else {
+			next = reflect.New(t).Elem()
+			next.Set(like)
+		}
+		for i, item := range items {
+			elem := reflect.Zero(t.Elem())
+			if i < like.Len() {
+				elem = like.Index(i)
+			}
+			inner, err := fromConfig(item, elem)
+			if err != nil {
+				return like, err
+			}
+			next.Index(i).Set(inner)
+		}
+		return next, nil
+	case reflect.Map:
+		entries, ok := toMap(raw)
+		if !ok {
+			return like, fmt.Errorf("Can't set %v to %v", t, raw)
+		}
+		next := reflect.MakeMap(t)
+		for _, key := range like.MapKeys() {
+			next.SetMapIndex(key, like.MapIndex(key))
+		}
+		for name, value := range entries {
+			key, ok := mapKey(like, name)
+			elem := reflect.Zero(t.Elem())
+			if ok {
+				elem = like.MapIndex(key)
+			} else {
+				var err error
+				if key, err = parseKey(name, t.Key()); err != nil {
+					return like, err
+				}
+			}
+			inner, err := fromConfig(value, elem)
+			if err != nil {
+				return like, err
+			}
+			next.SetMapIndex(key, inner)
+		}
+		return next, nil
+	default:
+		return convert(raw, t)
+	}
+}
+
+// toMap converts the maps decoded from the config into string keyed
+// maps.
+func toMap(raw interface{}) (map[string]interface{}, bool) {
+	switch raw := raw.(type) {
+	case map[string]interface{}:
+		return raw, true
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{})
+		for key, value := range raw {
+			m[fmt.Sprint(key)] = value
+		}
+		return m, true
+	default:
+		return nil, false
+	}
+}
+
+// parseKey converts name into a map key of type t.
+func parseKey(name string, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.String {
+		return reflect.ValueOf(name).Convert(t), nil
+	}
+	if isNumberKind(t.Kind()) {
+		if f, err := strconv.ParseFloat(name, 64); err == nil {
+			return reflect.ValueOf(f).Convert(t), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("Can't use %v as a %v key", name, t)
+}
+
+// OnValidity adds a hook that is called when any param becomes valid
+// or goes stale.  Hooks may be called from any goroutine and must not
+// block.
+func (ps *Params) OnValidity(hook ValidityHook) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.validity = append(ps.validity, hook)
+}
+
+func (ps *Params) notifyValidity(p *Param, ok bool) {
+	ps.mu.Lock()
+	hooks := ps.validity
+	ps.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(p, ok)
+	}
+}
+
+// Unmarshal decodes the config at the given key, relative to the
+// root, into raw.
+func (ps *Params) Unmarshal(key string, raw interface{}) error {
+	return ps.viper.UnmarshalKey(ps.Name+"."+key, raw)
 }
@@ -0,0 +1,343 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// paramInfo describes a param in the HTTP API.
+type paramInfo struct {
+	Name  string
+	Type  string
+	Value interface{}
+	// Age is the seconds since the last update, or nil if never
+	// set.
+	Age  *float64 `json:",omitempty"`
+	Ok   bool
+	Meta *Meta `json:",omitempty"`
+}
+
+func (p *Param) info() *paramInfo {
+	info := &paramInfo{
+		Name:  p.Name,
+		Type:  fmt.Sprintf("%T", p.Get()),
+		Value: p.Get(),
+		Ok:    p.Ok(),
+		Meta:  p.meta,
+	}
+	if age, ok := p.Age(); ok {
+		seconds := age.Seconds()
+		info.Age = &seconds
+	}
+	return info
+}
+
+// find returns the param with the given name or nil.
+func (ps *Params) find(name string) *Param {
+	for _, p := range ps.All() {
+		if strings.EqualFold(p.Name, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// findLeaf returns the param holding the given leaf and the path to
+// the leaf within the param's value.
+func (ps *Params) findLeaf(name string) (*Param, []string, reflect.Value) {
+	full := makeName([]string{ps.Name, name})
+
+	var owner *Param
+	var leaf reflect.Value
+	ps.WalkLeaves(func(p *Param, pname string, v reflect.Value) {
+		if pname == full && owner == nil {
+			owner, leaf = p, v
+		}
+	})
+	if owner == nil {
+		return nil, nil, leaf
+	}
+
+	prefix := makeName([]string{owner.Name}) + "."
+	rest := strings.TrimPrefix(strings.ToLower(name), prefix)
+	return owner, strings.Split(rest, "."), leaf
+}
+
+// API serves the params as JSON.  A GET of the root lists all params.
+// A GET of a name returns that param, the leaf within a param, or all
+// params below that name.  A GET with ?history=60s returns the
+// recorded values of a param.  A PUT or POST sets the param or leaf
+// from JSON, checking that the type matches the current value.
+func (ps *Params) API(w http.ResponseWriter, req *http.Request) {
+	name := strings.Trim(req.URL.Path, "/")
+	name = strings.Replace(name, "/", ".", -1)
+
+	switch req.Method {
+	case "GET":
+		if since, ok := req.URL.Query()["history"]; ok {
+			ps.apiHistory(w, name, since[0])
+			return
+		}
+		ps.apiGet(w, name)
+	case "PUT", "POST":
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := ps.apiSet(name, data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ps.apiGet(w, name)
+	default:
+		http.Error(w, "GET, PUT, or POST only", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (ps *Params) apiGet(w http.ResponseWriter, name string) {
+	if name == "" {
+		var all []*paramInfo
+		for _, p := range ps.All() {
+			all = append(all, p.info())
+		}
+		writeJSON(w, all)
+		return
+	}
+
+	if p := ps.find(name); p != nil {
+		writeJSON(w, p.info())
+		return
+	}
+
+	// All params below this name.
+	prefix := strings.ToLower(name) + "."
+	below := make(map[string]*paramInfo)
+	for _, p := range ps.All() {
+		if strings.HasPrefix(strings.ToLower(p.Name), prefix) {
+			below[p.Name] = p.info()
+		}
+	}
+	if len(below) != 0 {
+		writeJSON(w, below)
+		return
+	}
+
+	if p, _, leaf := ps.findLeaf(name); p != nil {
+		writeJSON(w, map[string]interface{}{
+			"Name":  name,
+			"Type":  leaf.Type().String(),
+			"Value": leaf.Interface(),
+			"Ok":    p.Ok(),
+		})
+		return
+	}
+
+	http.Error(w, fmt.Sprintf("No param %v", name), http.StatusNotFound)
+}
+
+func (ps *Params) apiHistory(w http.ResponseWriter, name, since string) {
+	p := ps.find(name)
+	if p == nil {
+		http.Error(w, fmt.Sprintf("No param %v", name), http.StatusNotFound)
+		return
+	}
+
+	age := time.Duration(0)
+	if since != "" {
+		var err error
+		if age, err = asDuration(since); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	samples := p.History(age)
+	if samples == nil {
+		http.Error(w, fmt.Sprintf("%v isn't recorded", name), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, samples)
+}
+
+func (ps *Params) apiSet(name string, data []byte) error {
+	if p := ps.find(name); p != nil {
+		next, err := decodeAs(p.Get(), data)
+		if err != nil {
+			return fmt.Errorf("%v: %v", p.Name, err)
+		}
+		return p.SetExternal(next)
+	}
+
+	p, path, leaf := ps.findLeaf(name)
+	if p == nil {
+		return fmt.Errorf("No param %v", name)
+	}
+
+	value, err := decodeAs(leaf.Interface(), data)
+	if err != nil {
+		return fmt.Errorf("%v: %v", name, err)
+	}
+	if err := p.CheckLeaf(path, value); err != nil {
+		return err
+	}
+	return p.SetLeaf(path, value)
+}
+
+// clone returns a deep copy of v so that decoding JSON into the copy
+// doesn't modify the original.
+func clone(v reflect.Value) reflect.Value {
+	t := v.Type()
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		next := reflect.New(t.Elem())
+		next.Elem().Set(clone(v.Elem()))
+		return next
+	case reflect.Struct:
+		next := reflect.New(t).Elem()
+		next.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if next.Field(i).CanSet() {
+				next.Field(i).Set(clone(v.Field(i)))
+			}
+		}
+		return next
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		next := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			next.Index(i).Set(clone(v.Index(i)))
+		}
+		return next
+	case reflect.Array:
+		next := reflect.New(t).Elem()
+		for i := 0; i < v.Len(); i++ {
+			next.Index(i).Set(clone(v.Index(i)))
+		}
+		return next
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		next := reflect.MakeMap(t)
+		for _, key := range v.MapKeys() {
+			next.SetMapIndex(key, clone(v.MapIndex(key)))
+		}
+		return next
+	default:
+		return v
+	}
+}
+
+// decodeAs decodes JSON into a value of the same type as like.  The
+// JSON may hold a subset of the fields of a struct.
+func decodeAs(like interface{}, data []byte) (interface{}, error) {
+	if like == nil {
+		return nil, errors.New("Has no value to check the type against")
+	}
+	if string(bytes.TrimSpace(data)) == "null" {
+		return nil, errors.New("Can't set to null")
+	}
+
+	next := reflect.New(reflect.TypeOf(like))
+	next.Elem().Set(clone(reflect.ValueOf(like)))
+
+	if err := json.Unmarshal(data, next.Interface()); err != nil {
+		return nil, err
+	}
+	if err := checkFields(reflect.TypeOf(like), data); err != nil {
+		return nil, err
+	}
+	return next.Elem().Interface(), nil
+}
+
+// checkFields returns an error if the JSON has fields that aren't in
+// the given type.
+func checkFields(t reflect.Type, data []byte) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := checkFields(t.Elem(), item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		var items map[string]json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := checkFields(t.Elem(), item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+	default:
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	for name, raw := range fields {
+		field, ok := t.FieldByNameFunc(func(field string) bool {
+			return strings.EqualFold(field, name)
+		})
+		if !ok {
+			return fmt.Errorf("Unknown field %v in %v", name, t)
+		}
+		if err := checkFields(field.Type, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func request(ps *Params, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	ps.API(w, req)
+	return w
+}
+
+func TestAPIGet(t *testing.T) {
+	ps := &Params{Name: "root"}
+	ps.NewWith("foo.bar", 17.0)
+	ps.NewWith("foo.baz", "texty")
+	ps.NewWith("blob", &TestParamStructT{1, 2, 3})
+	ps.New("never")
+
+	// List everything.
+	w := request(ps, "GET", "/", "")
+	var all []map[string]interface{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &all))
+	assert.Equal(t, len(all), 4)
+	assert.Equal(t, all[0]["Name"], "foo.bar")
+	assert.Equal(t, all[0]["Type"], "float64")
+	assert.Equal(t, all[0]["Ok"], true)
+	assert.Nil(t, all[3]["Age"])
+
+	// A single param.
+	w = request(ps, "GET", "/blob", "")
+	assert.Contains(t, w.Body.String(), `"B": 2`)
+
+	// A subtree.
+	w = request(ps, "GET", "/foo", "")
+	var below map[string]interface{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &below))
+	assert.Equal(t, len(below), 2)
+
+	// A leaf.
+	w = request(ps, "GET", "/blob/c", "")
+	assert.Contains(t, w.Body.String(), `"Value": 3`)
+
+	w = request(ps, "GET", "/missing", "")
+	assert.Equal(t, w.Code, http.StatusNotFound)
+}
+
+func TestAPISet(t *testing.T) {
+	ps := &Params{Name: "root"}
+	num := ps.NewWith("num", 17.0)
+	blob := ps.NewWith("blob", &TestParamStructT{1, 2, 3})
+	before := blob.Get().(*TestParamStructT)
+
+	w := request(ps, "PUT", "/num", "18.5")
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, num.GetFloat64(), 18.5)
+
+	// Partial struct update.
+	w = request(ps, "PUT", "/blob", `{"A": 5, "c": 6.5}`)
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, blob.Get(), &TestParamStructT{5, 2, 6.5})
+	// The original value isn't modified in place.
+	assert.Equal(t, before.A, 1)
+
+	// Single leaf.
+	w = request(ps, "POST", "/blob/b", `7`)
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, blob.Get(), &TestParamStructT{5, 7, 6.5})
+
+	// Type mismatches are rejected.
+	for _, bad := range []struct{ path, body string }{
+		{"/num", `"text"`},
+		{"/num", `null`},
+		{"/blob", `{"D": 1}`},
+		{"/blob", `{"A": 1.5}`},
+		{"/blob/a", `"text"`},
+		{"/missing", `1`},
+	} {
+		w = request(ps, "PUT", bad.path, bad.body)
+		assert.Equal(t, w.Code, http.StatusBadRequest, bad.path+" "+bad.body)
+	}
+	assert.Equal(t, blob.Get(), &TestParamStructT{5, 7, 6.5})
+}
+
+func TestAPIContainers(t *testing.T) {
+	ps := &Params{Name: "root"}
+	p := ps.NewWith("pantilt", &testPresets{
+		Presets: []*testPreset{{1, 2}, {3, 4}},
+		Rovers:  map[string]int{"a": 1},
+	})
+	before := p.Get().(*testPresets)
+
+	w := request(ps, "PUT", "/pantilt/presets/1/yaw", "5")
+	assert.Equal(t, w.Code, http.StatusOK)
+	w = request(ps, "PUT", "/pantilt", `{"Rovers": {"b": 2}, "Presets": [{"Yaw": 6}]}`)
+	assert.Equal(t, w.Code, http.StatusOK)
+	w = request(ps, "PUT", "/pantilt", `{"Presets": [{"Roll": 6}]}`)
+	assert.Equal(t, w.Code, http.StatusBadRequest)
+
+	// Elements are updated in place like structs.
+	after := p.Get().(*testPresets)
+	assert.Equal(t, after.Presets, []*testPreset{{6, 2}})
+	assert.Equal(t, after.Rovers, map[string]int{"a": 1, "b": 2})
+	// The old value is unchanged.
+	assert.Equal(t, before.Presets[1].Yaw, 3.0)
+	assert.Equal(t, before.Rovers, map[string]int{"a": 1})
+}
+
+func TestAPIConcurrent(t *testing.T) {
+	ps := &Params{Name: "root"}
+	ps.NewWith("foo.bar", 17.0)
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			ps.NewNum(fmt.Sprintf("more%d", i))
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		request(ps, "GET", "/", "")
+		request(ps, "GET", "/foo", "")
+		request(ps, "GET", "/foo/bar", "")
+	}
+	<-done
+}
@@ -16,79 +16,200 @@
 package param
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
-	"gobot.io/x/gobot/platforms/mqtt"
 	"juju.nz/x/pipoint/util"
 )
 
 const (
-	publishLimit = 0.2
+	// discoveryLimit is the seconds between publishing the
+	// discovery document.
+	discoveryLimit = 60
+
+	statusOnline  = "online"
+	statusOffline = "offline"
 )
 
-// ParamMQTTBridge exposes parameters over MQTT.
+// discoveryLeaf describes one leaf topic in the discovery document.
+type discoveryLeaf struct {
+	Topic string
+	Type  string
+	Meta
+}
+
+// ParamMQTTBridge exposes parameters over MQTT.  Updates are
+// published to <device>/<params>/<param>/<leaf>, and writes to the
+// same topic with /set appended update the param.  Structs can also
+// be set as a whole by writing JSON to <param>/set and, in JSON mode,
+// are published as JSON to <param>.
 type ParamMQTTBridge struct {
-	params    *Params
-	adaptor   *mqtt.Adaptor
-	prefix    string
-	limiter   *util.Limiter
-	listening bool
+	params  *Params
+	client  mqttClient
+	options MQTTOptions
+	prefix  string
+
+	throttle *throttle
+
+	mu      sync.Mutex
+	limiter *util.Limiter
 }
 
-// NewParamMQTTBridge creates a new two way connection between MQTT
-// and the given params.
-func NewParamMQTTBridge(params *Params, adaptor *mqtt.Adaptor, device string) *ParamMQTTBridge {
-	if device == "" {
-		device, _ = os.Hostname()
+// NewParamMQTTBridge connects to the MQTT server and creates a two
+// way connection between MQTT and the given params.  On every connect
+// the bridge subscribes, sets <prefix>/$status to online, publishes
+// the build label to <prefix>/$build_label, and publishes the current
+// value of every param.  The server sets the status to offline if the
+// connection is lost.
+func NewParamMQTTBridge(params *Params, options *MQTTOptions) (*ParamMQTTBridge, error) {
+	b := newBridge(params, nil, options)
+	client, err := newPahoClient(&b.options, b.prefix+"/$status", b.connected)
+	if err != nil {
+		return nil, err
 	}
-	prefix := strings.Join([]string{device, params.Name}, "/")
+	b.client = client
+	b.start()
+	client.connect()
+	return b, nil
+}
 
+func newBridge(params *Params, client mqttClient, options *MQTTOptions) *ParamMQTTBridge {
 	b := &ParamMQTTBridge{
 		params:  params,
-		adaptor: adaptor,
-		prefix:  prefix,
+		client:  client,
+		options: *options,
 		limiter: util.NewLimiter(),
 	}
-	changed := make(chan *Param, 10)
-	params.Listen(changed)
+	if b.options.Device == "" {
+		b.options.Device, _ = os.Hostname()
+	}
+	b.prefix = strings.Join([]string{b.options.Device, params.Name}, "/")
+	b.throttle = newThrottle(b.options.Interval, func(topic string, payload []byte, retained bool) {
+		b.client.Publish(topic, b.options.QoS, retained, payload)
+	})
+	if params.viper != nil {
+		b.loaded(params)
+		params.OnLoad(b.loaded)
+	}
+	return b
+}
+
+// start publishes param updates.
+func (b *ParamMQTTBridge) start() {
+	changed := b.params.Subscribe(&SubscribeOptions{Name: "mqtt"})
 
 	go func() {
-		for {
-			b.publish(<-changed)
+		for p := range changed.C {
+			b.publish(p, false)
 		}
 	}()
-	return b
 }
 
-func (b *ParamMQTTBridge) publish(param *Param) {
+// connected subscribes and sends the birth messages and current
+// values.
+func (b *ParamMQTTBridge) connected() {
+	qos := b.options.QoS
+	b.client.Subscribe(b.prefix+"/#", qos, b.recv)
+	b.client.Publish(b.prefix+"/$status", qos, true, []byte(statusOnline))
+	if b.options.BuildLabel != "" {
+		b.client.Publish(b.prefix+"/$build_label", qos, true, []byte(b.options.BuildLabel))
+	}
+
+	if b.options.HomeAssistant != "" {
+		b.publishHomeAssistant()
+	}
+
+	for _, p := range b.params.All() {
+		b.publish(p, true)
+	}
+}
+
+// retained returns true if the updates should be retained by the
+// server so that new clients see them.
+func (p *Param) retained() bool {
+	return (p.meta != nil && p.meta.Retain) || p.persistent()
+}
+
+// publish sends the leaves of a param.  Updates are throttled unless
+// forced.
+func (b *ParamMQTTBridge) publish(param *Param, force bool) {
 	base := b.prefix + "/"
+	retained := param.retained()
 
 	param.Walk(func(p *Param, path []string, value interface{}) {
-		name := base + strings.Join(path, "/")
-		name = strings.ToLower(strings.Replace(name, ".", "/", -1))
+		name := strings.Join(path, ".")
+		topic := base + strings.ToLower(strings.Replace(name, ".", "/", -1))
+		formatted := fmt.Sprintf("%v", value)
+		b.throttle.push(topic, name, []byte(formatted), value, retained, force)
+	})
 
-		if b.limiter.Ok(name, publishLimit) {
-			formatted := fmt.Sprintf("%v", value)
-			b.adaptor.Publish(name, []byte(formatted))
+	if b.options.JSON && !isScalar(param.Get()) {
+		topic := base + strings.ToLower(strings.Replace(param.Name, ".", "/", -1))
+		if data, err := json.Marshal(param.Get()); err == nil {
+			b.throttle.push(topic, param.Name, data, nil, retained, force)
 		}
-	})
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limiter.Ok(b.prefix+"/$meta", discoveryLimit) || force {
+		if doc, err := b.params.discovery(b.prefix); err == nil {
+			b.client.Publish(b.prefix+"/$meta", b.options.QoS, true, doc)
+		}
+	}
+}
+
+// loaded reads the per topic interval and deadband from the config.
+func (b *ParamMQTTBridge) loaded(ps *Params) {
+	interval := make(map[string]time.Duration)
+	deadband := make(map[string]float64)
 
-	// TODO(michaelh): listen on connect.
-	if !b.listening {
-		b.listening = b.adaptor.On(b.prefix+"/#", b.recv)
+	var raw map[string]interface{}
+	if err := ps.Unmarshal("mqtt.interval", &raw); err != nil {
+		log.Printf("mqtt.interval: %v\n", err)
 	}
+	for name, value := range flatten("", raw) {
+		d, err := asDuration(value)
+		if err != nil {
+			log.Printf("mqtt.interval: %v: %v\n", name, err)
+			continue
+		}
+		interval[strings.ToLower(name)] = d
+	}
+
+	raw = nil
+	if err := ps.Unmarshal("mqtt.deadband", &raw); err != nil {
+		log.Printf("mqtt.deadband: %v\n", err)
+	}
+	for name, value := range flatten("", raw) {
+		f, err := asNumber(value)
+		if err != nil {
+			log.Printf("mqtt.deadband: %v: %v\n", name, err)
+			continue
+		}
+		deadband[strings.ToLower(name)] = f
+	}
+
+	b.throttle.configure(interval, deadband)
 }
 
-func (b *ParamMQTTBridge) recv(msg mqtt.Message) {
+func (b *ParamMQTTBridge) recv(msg Message) {
 	topic := msg.Topic()
-	if !strings.HasSuffix(topic, "/set") {
+	if !strings.HasPrefix(topic, b.prefix) {
 		return
 	}
-	if !strings.HasPrefix(topic, b.prefix) {
+	if strings.HasSuffix(topic, "/history/get") {
+		b.history(msg)
+		return
+	}
+	if !strings.HasSuffix(topic, "/set") {
 		return
 	}
 
@@ -97,6 +218,14 @@ func (b *ParamMQTTBridge) recv(msg mqtt.Message) {
 	// Drop the device/ and /set.
 	name := strings.Join(parts[1:len(parts)-1], ".")
 
+	// Structs are set as a whole from JSON.
+	if p := b.params.find(strings.Join(parts[2:len(parts)-1], ".")); p != nil && !isScalar(p.Get()) {
+		if err := b.setJSON(p, msg.Payload()); err != nil {
+			log.Printf("mqtt: %v: %v\n", p.Name, err)
+		}
+		return
+	}
+
 	// Parse the data to a number or string.
 	var next interface{}
 	value := string(msg.Payload())
@@ -110,11 +239,95 @@ func (b *ParamMQTTBridge) recv(msg mqtt.Message) {
 
 	b.params.WalkLeaves(func(p *Param, pname string, v reflect.Value) {
 		if pname == name {
-			if v.CanSet() {
-				v.Set(reflect.ValueOf(next))
-			} else {
-				p.Set(next)
+			path := b.params.leafPath(p, pname)
+			if err := p.CheckLeaf(path, next); err != nil {
+				log.Printf("mqtt: %v\n", err)
+				return
+			}
+			if err := p.SetLeaf(path, next); err != nil {
+				log.Printf("mqtt: %v\n", err)
 			}
 		}
 	})
 }
+
+// isScalar returns true if the value is a single leaf such as a
+// number or string.
+func isScalar(value interface{}) bool {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+		return false
+	default:
+		return true
+	}
+}
+
+// setJSON sets a whole param from JSON in one update.  The JSON must
+// match the type of the current value but may hold a subset of the
+// fields.
+func (b *ParamMQTTBridge) setJSON(p *Param, data []byte) error {
+	next, err := decodeAs(p.Get(), data)
+	if err != nil {
+		return err
+	}
+	return p.SetExternal(next)
+}
+
+// discovery returns a JSON document describing the topic, type, and
+// metadata of every leaf.
+func (ps *Params) discovery(prefix string) ([]byte, error) {
+	var leaves []*discoveryLeaf
+
+	ps.WalkLeaves(func(p *Param, name string, v reflect.Value) {
+		rel := strings.TrimPrefix(name, makeName([]string{ps.Name})+".")
+		leaf := &discoveryLeaf{
+			Topic: prefix + "/" + strings.Replace(rel, ".", "/", -1),
+			Type:  "unknown",
+		}
+		if v.IsValid() {
+			leaf.Type = v.Type().String()
+		}
+		if meta := p.meta.leaf(ps.leafPath(p, name)); meta != nil {
+			leaf.Meta = *meta
+			leaf.Leaves = nil
+		}
+		if p.meta != nil && p.meta.ReadOnly {
+			leaf.ReadOnly = true
+		}
+		leaves = append(leaves, leaf)
+	})
+	return json.Marshal(leaves)
+}
+
+// history publishes the recorded values of a param as JSON in
+// response to a <param>/history/get request.  The payload is the
+// optional age such as 60 or 500ms.
+func (b *ParamMQTTBridge) history(msg Message) {
+	topic := strings.TrimSuffix(msg.Topic(), "/get")
+	name := strings.TrimPrefix(topic, b.prefix+"/")
+	name = strings.TrimSuffix(name, "/history")
+
+	p := b.params.find(strings.Replace(name, "/", ".", -1))
+	if p == nil {
+		return
+	}
+
+	age := time.Duration(0)
+	if payload := string(msg.Payload()); payload != "" {
+		var err error
+		if age, err = asDuration(payload); err != nil {
+			log.Printf("mqtt: %v: %v\n", topic, err)
+			return
+		}
+	}
+
+	if samples := p.History(age); samples != nil {
+		if data, err := json.Marshal(samples); err == nil {
+			b.client.Publish(topic, b.options.QoS, false, data)
+		}
+	}
+}
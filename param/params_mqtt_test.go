@@ -0,0 +1,230 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPublish struct {
+	retained bool
+	payload  string
+}
+
+type testMessage struct {
+	topic   string
+	payload string
+}
+
+func (m *testMessage) Topic() string   { return m.topic }
+func (m *testMessage) Payload() []byte { return []byte(m.payload) }
+
+// testClient records publishes and subscriptions.
+type testClient struct {
+	mu        sync.Mutex
+	published map[string]testPublish
+	handlers  map[string]func(msg Message)
+	// onPublish is called after each publish if set.
+	onPublish func(topic string, payload []byte)
+}
+
+func newTestClient() *testClient {
+	return &testClient{
+		published: make(map[string]testPublish),
+		handlers:  make(map[string]func(msg Message)),
+	}
+}
+
+func (c *testClient) Publish(topic string, qos byte, retained bool, payload []byte) {
+	c.mu.Lock()
+	c.published[topic] = testPublish{retained, string(payload)}
+	onPublish := c.onPublish
+	c.mu.Unlock()
+
+	if onPublish != nil {
+		onPublish(topic, payload)
+	}
+}
+
+func (c *testClient) Subscribe(topic string, qos byte, handler func(msg Message)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[topic] = handler
+}
+
+func TestBridgeConnected(t *testing.T) {
+	ps := &Params{Name: "root"}
+	state := ps.NewWith("state", 2.0, &Meta{Retain: true})
+	speed := ps.NewWith("speed", 3.0)
+	ps.NewNum("never")
+
+	client := newTestClient()
+	b := newBridge(ps, client, &MQTTOptions{Device: "dev", BuildLabel: "v1"})
+	b.connected()
+
+	assert.Equal(t, client.published["dev/root/$status"], testPublish{true, "online"})
+	assert.Equal(t, client.published["dev/root/$build_label"], testPublish{true, "v1"})
+	assert.Equal(t, client.published["dev/root/state"], testPublish{true, "2"})
+	assert.Equal(t, client.published["dev/root/speed"], testPublish{false, "3"})
+	assert.True(t, client.published["dev/root/$meta"].retained)
+
+	// Writes arrive through the subscription.
+	recv := client.handlers["dev/root/#"]
+	assert.NotNil(t, recv)
+	recv(&testMessage{"dev/root/speed/set", "4.5"})
+	assert.Equal(t, speed.GetFloat64(), 4.5)
+
+	// Updates are held for the interval, but a reconnect sends
+	// everything straight away.
+	state.SetFloat64(3)
+	b.publish(state, false)
+	assert.Equal(t, client.published["dev/root/state"].payload, "2")
+
+	client.handlers = make(map[string]func(msg Message))
+	b.connected()
+	assert.Equal(t, client.published["dev/root/state"].payload, "3")
+	assert.NotNil(t, client.handlers["dev/root/#"])
+}
+
+func TestBridgeJSON(t *testing.T) {
+	ps := &Params{Name: "root"}
+	blob := ps.NewWith("pan.blob", &TestParamStructT{1, 2, 3}, &Meta{
+		Leaves: map[string]*Meta{"c": {Max: 10}},
+	})
+	ps.NewWith("speed", 3.0)
+
+	client := newTestClient()
+	b := newBridge(ps, client, &MQTTOptions{Device: "dev", JSON: true})
+	b.connected()
+
+	assert.Equal(t, client.published["dev/root/pan/blob"].payload, `{"A":1,"B":2,"C":3}`)
+	assert.Equal(t, client.published["dev/root/pan/blob/c"].payload, "3")
+	assert.Equal(t, client.published["dev/root/speed"].payload, "3")
+
+	// Set all fields at once.
+	recv := client.handlers["dev/root/#"]
+	recv(&testMessage{"dev/root/pan/blob/set", `{"A": 4, "C": 5}`})
+	assert.Equal(t, blob.Get(), &TestParamStructT{4, 2, 5})
+
+	// Bad JSON, unknown fields, and out of range values are dropped.
+	recv(&testMessage{"dev/root/pan/blob/set", `{"A": 5`})
+	recv(&testMessage{"dev/root/pan/blob/set", `{"D": 5}`})
+	recv(&testMessage{"dev/root/pan/blob/set", `{"A": 6, "C": 11}`})
+	assert.Equal(t, blob.Get(), &TestParamStructT{4, 2, 5})
+}
+
+func TestBridgeHomeAssistant(t *testing.T) {
+	ps := &Params{Name: "root"}
+	ps.NewNum("state", &Meta{Description: "State", Enum: []string{"A", "B"}})
+	ps.NewNum("link", &Meta{Enum: []string{"Up", "Down"}, ReadOnly: true})
+	ps.NewNum("mark", &Meta{Action: true})
+	ps.NewNum("pan.sp", &Meta{Unit: "rad"})
+	ps.NewNum("internal")
+	ps.NewWith("blob", &TestParamStructT{1, 2, 3}, &Meta{
+		Leaves: map[string]*Meta{"a": {Description: "A count", Min: -1, Max: 7}},
+	})
+
+	client := newTestClient()
+	b := newBridge(ps, client, &MQTTOptions{Device: "dev.1", HomeAssistant: "ha", BuildLabel: "v1"})
+	b.connected()
+
+	get := func(topic string) map[string]interface{} {
+		var config map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(client.published[topic].payload), &config), topic)
+		assert.True(t, client.published[topic].retained)
+		return config
+	}
+
+	state := get("ha/select/dev_1/state/config")
+	assert.Equal(t, state["name"], "State")
+	assert.Equal(t, state["unique_id"], "dev_1_root_state")
+	assert.Equal(t, state["state_topic"], "dev.1/root/state")
+	assert.Equal(t, state["command_topic"], "dev.1/root/state/set")
+	assert.Equal(t, state["availability_topic"], "dev.1/root/$status")
+	assert.Equal(t, state["value_template"], `{{ ["A","B"][value | int] }}`)
+	assert.Equal(t, state["command_template"], `{{ ["A","B"].index(value) }}`)
+
+	link := get("ha/sensor/dev_1/link/config")
+	assert.Nil(t, link["command_topic"])
+
+	mark := get("ha/button/dev_1/mark/config")
+	assert.Equal(t, mark["payload_press"], "1")
+
+	sp := get("ha/number/dev_1/pan_sp/config")
+	assert.Equal(t, sp["unit_of_measurement"], "rad")
+	assert.Equal(t, sp["step"], 0.001)
+
+	a := get("ha/number/dev_1/blob_a/config")
+	assert.Equal(t, a["min"], -1.0)
+	assert.Equal(t, a["max"], 7.0)
+	assert.Equal(t, a["step"], 1.0)
+	assert.Equal(t, a["device"].(map[string]interface{})["sw_version"], "v1")
+
+	// Leaves without metadata are skipped.
+	assert.Equal(t, client.published["dev.1/root/internal"].payload, "0")
+	for topic := range client.published {
+		if strings.HasPrefix(topic, "ha/") {
+			assert.NotContains(t, topic, "internal")
+			assert.NotContains(t, topic, "blob_b")
+		}
+	}
+}
+
+func (c *testClient) get(topic string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.published[topic].payload
+}
+
+func TestBridgeThrottle(t *testing.T) {
+	ps := &Params{Name: "root", viper: viper.New()}
+	pos := ps.NewNum("pos")
+	speed := ps.NewNum("rover.speed")
+	ps.viper.Set("root.mqtt.deadband", map[string]interface{}{"rover": 0.5})
+
+	client := newTestClient()
+	b := newBridge(ps, client, &MQTTOptions{Device: "dev", Interval: 20 * time.Millisecond})
+
+	// The first is sent now and the last is sent at the end of the
+	// interval.
+	for _, v := range []float64{1, 2, 3} {
+		pos.SetFloat64(v)
+		b.publish(pos, false)
+	}
+	assert.Equal(t, client.get("dev/root/pos"), "1")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, client.get("dev/root/pos"), "3")
+
+	// Small changes are dropped.
+	speed.SetFloat64(3)
+	b.publish(speed, false)
+	time.Sleep(30 * time.Millisecond)
+	speed.SetFloat64(3.2)
+	b.publish(speed, false)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, client.get("dev/root/rover/speed"), "3")
+
+	speed.SetFloat64(4)
+	b.publish(speed, false)
+	assert.Equal(t, client.get("dev/root/rover/speed"), "4")
+}
@@ -0,0 +1,153 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// configFile returns the config file that was loaded, or the default
+// name if none was found.
+func (ps *Params) configFile() string {
+	if ps.viper != nil {
+		if name := ps.viper.ConfigFileUsed(); name != "" {
+			return name
+		}
+	}
+	return ps.Name + ".yml"
+}
+
+// Save writes the current value of all persistent params back to the
+// config file.  Slices and maps are written as a whole.  Other keys
+// and the leading comment block are kept, but comments within the
+// body are lost.  The file is replaced atomically.
+func (ps *Params) Save() error {
+	name := ps.configFile()
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yml", ".yaml":
+	default:
+		return fmt.Errorf("Can only save to YAML, not %v", name)
+	}
+
+	mode := os.FileMode(0644)
+	var data []byte
+	if info, err := os.Stat(name); err == nil {
+		mode = info.Mode()
+		if data, err = ioutil.ReadFile(name); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	var root yaml.MapSlice
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("%v: %v", name, err)
+	}
+
+	for _, p := range ps.All() {
+		if !p.persistent() {
+			continue
+		}
+		ps.visitOne(p, func(p *Param, name string, v reflect.Value) {
+			if !v.IsValid() || !v.CanInterface() {
+				return
+			}
+			root = setPath(root, strings.Split(name, "."), v.Interface())
+		}, []string{ps.Name, p.Name}, reflect.ValueOf(p.Get()), true)
+	}
+
+	body, err := yaml.Marshal(root)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(leadingComments(data))
+	buf.Write(body)
+	return writeAtomic(name, buf.Bytes(), mode)
+}
+
+// setPath sets the value at the given path, matching keys in any case
+// and adding maps as needed.
+func setPath(m yaml.MapSlice, path []string, value interface{}) yaml.MapSlice {
+	for i := range m {
+		if !strings.EqualFold(fmt.Sprint(m[i].Key), path[0]) {
+			continue
+		}
+		if len(path) == 1 {
+			m[i].Value = value
+		} else {
+			child, _ := m[i].Value.(yaml.MapSlice)
+			m[i].Value = setPath(child, path[1:], value)
+		}
+		return m
+	}
+
+	item := yaml.MapItem{Key: path[0], Value: value}
+	if len(path) > 1 {
+		item.Value = setPath(nil, path[1:], value)
+	}
+	return append(m, item)
+}
+
+// leadingComments returns the comment and blank lines at the start of
+// the file.
+func leadingComments(data []byte) string {
+	var buf bytes.Buffer
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		buf.WriteString(line)
+	}
+	return buf.String()
+}
+
+// writeAtomic writes data to a temporary file in the same directory
+// and then renames it over name.
+func writeAtomic(name string, data []byte, mode os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
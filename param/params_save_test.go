@@ -0,0 +1,128 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+type saveTest struct {
+	Yaw   float64
+	Pitch float64
+}
+
+func TestSetPath(t *testing.T) {
+	var m yaml.MapSlice
+	yaml.Unmarshal([]byte("a:\n  b: 1\n  c: 2\nd: 3\n"), &m)
+
+	m = setPath(m, []string{"A", "C"}, 5)
+	m = setPath(m, []string{"e", "f"}, 6)
+
+	out, _ := yaml.Marshal(m)
+	assert.Equal(t, "a:\n  b: 1\n  c: 5\nd: 3\ne:\n  f: 6\n", string(out))
+}
+
+func newSaveParams(t *testing.T, config string) (*Params, string) {
+	dir, err := ioutil.TempDir("", "params")
+	assert.Nil(t, err)
+
+	name := filepath.Join(dir, "test.yml")
+	assert.Nil(t, ioutil.WriteFile(name, []byte(config), 0600))
+
+	ps := &Params{Name: "test", viper: viper.New()}
+	ps.viper.SetConfigFile(name)
+	assert.Nil(t, ps.viper.ReadInConfig())
+	return ps, name
+}
+
+func TestSave(t *testing.T) {
+	ps, name := newSaveParams(t, `# Comment.
+
+test:
+  # Lost.
+  offset:
+    yaw: 1.5
+  other: 7
+`)
+	defer os.RemoveAll(filepath.Dir(name))
+
+	offset := ps.NewWith("offset", &saveTest{})
+	offset.Persist()
+	ps.NewNum("tick").Persist()
+	ps.NewWith("state", 3.0)
+
+	ps.Load()
+	assert.Equal(t, 1.5, offset.Get().(*saveTest).Yaw)
+	assert.True(t, offset.final)
+
+	offset.Set(&saveTest{Yaw: 2, Pitch: 0.5})
+	assert.Nil(t, ps.Save())
+
+	got, err := ioutil.ReadFile(name)
+	assert.Nil(t, err)
+	// Unknown keys and the header are kept.  tick was never set
+	// and state isn't persistent.
+	assert.Equal(t, `# Comment.
+
+test:
+  offset:
+    yaw: 2
+    pitch: 0.5
+  other: 7
+`, string(got))
+
+	info, err := os.Stat(name)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode())
+}
+
+func TestSaveNotYAML(t *testing.T) {
+	ps, name := newSaveParams(t, "")
+	defer os.RemoveAll(filepath.Dir(name))
+
+	ps.viper.SetConfigFile(name + ".json")
+	assert.NotNil(t, ps.Save())
+}
+
+func TestSaveContainers(t *testing.T) {
+	ps, name := newSaveParams(t, "")
+	defer os.RemoveAll(filepath.Dir(name))
+
+	p := ps.NewWith("pantilt", &testPresets{
+		Presets: []*testPreset{{1, 2}},
+		Rovers:  map[string]int{"a": 1},
+	})
+	p.Persist()
+	assert.Nil(t, ps.Save())
+
+	got, err := ioutil.ReadFile(name)
+	assert.Nil(t, err)
+	assert.Equal(t, `test:
+  pantilt:
+    presets:
+    - yaw: 1
+      pitch: 2
+    rovers:
+      a: 1
+`, string(got))
+}
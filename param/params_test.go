@@ -16,26 +16,46 @@
 package param
 
 import (
-	"reflect"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func TestParamsFormat(t *testing.T) {
-	ps := Params{}
-
-	// Whole numbers print as ints.
-	p := ps.NewWith("foo", 17.0)
-	assert.Equal(t, format("foo", reflect.ValueOf(p.Get())), "foo 17")
-
-	p.SetFloat64(17.1)
-	assert.Equal(t, format("foo", reflect.ValueOf(p.Get())), "foo 17.1")
-
-	// Strings show only if set.
-	p2 := ps.NewWith("bar", "texty")
-	assert.Equal(t, format("foo", reflect.ValueOf(p2.Get())), "foo{value=\"texty\"} 1")
+func TestParamsMetrics(t *testing.T) {
+	ps := &Params{Name: "root"}
+	ps.NewWith("foo", 17.0)
+	ps.NewWith("count", 3, &Meta{Counter: true})
+	ps.NewWith("state", "texty")
+	ps.NewWith("empty", "")
+	ps.NewWith("blob", &TestParamStructT{1, 2, 3.5})
+	ps.NewWith("rovers", map[string]bool{"a": true})
+	ps.New("never")
+
+	w := httptest.NewRecorder()
+	ps.Metrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	assert.Contains(t, body, "# TYPE root_foo gauge\nroot_foo 17\n")
+	assert.Contains(t, body, "# TYPE root_count counter\nroot_count 3\n")
+	assert.Contains(t, body, "root_state_info{value=\"texty\"} 1\n")
+	assert.NotContains(t, body, "root_empty")
+	assert.Contains(t, body, "root_blob{leaf=\"a\"} 1\nroot_blob{leaf=\"b\"} 2\nroot_blob{leaf=\"c\"} 3.5\n")
+	assert.Contains(t, body, "root_rovers{leaf=\"a\"} 1\n")
+
+	// Staleness.
+	assert.Contains(t, body, "root_param_ok{param=\"foo\"} 1\n")
+	assert.Contains(t, body, "root_param_ok{param=\"never\"} 0\n")
+	assert.Contains(t, body, "root_param_age_seconds{param=\"foo\"}")
+	assert.NotContains(t, body, "root_param_age_seconds{param=\"never\"}")
+
+	// The default registry is included.
+	assert.Contains(t, body, "go_goroutines")
+}
 
-	p2.Set("")
-	assert.Equal(t, format("foo", reflect.ValueOf(p2.Get())), "")
+func TestParamsDuplicate(t *testing.T) {
+	ps := &Params{Name: "root"}
+	ps.NewNum("foo.bar")
+	assert.Panics(t, func() { ps.NewNum("Foo.Bar") })
+	assert.Equal(t, len(ps.All()), 1)
 }
@@ -0,0 +1,297 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DefaultSize is the number of updates buffered by a
+	// subscription if none is given.
+	DefaultSize = 100
+)
+
+var (
+	listenerDelivered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "params_listener_delivered_total",
+		Help: "Param updates delivered to the listener.",
+	}, []string{"listener"})
+	listenerDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "params_listener_dropped_total",
+		Help: "Param updates dropped as the listener fell behind.",
+	}, []string{"listener"})
+	listenerCoalesced = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "params_listener_coalesced_total",
+		Help: "Param updates merged with an already queued update.",
+	}, []string{"listener"})
+	listenerQueued = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "params_listener_queued",
+		Help: "Param updates waiting for the listener.",
+	}, []string{"listener"})
+)
+
+func init() {
+	prometheus.MustRegister(listenerDelivered, listenerDropped, listenerCoalesced, listenerQueued)
+}
+
+// Policy is what a subscription does with an update when the listener
+// is behind.
+type Policy int
+
+const (
+	// Coalesce merges an update with one for the same param that
+	// is already queued.  If the queue is full then the oldest is
+	// dropped.
+	Coalesce Policy = iota
+	// DropOldest queues every update and drops the oldest if the
+	// queue is full.
+	DropOldest
+)
+
+// SubscribeOptions configures a subscription.  The zero value
+// coalesces all params into a buffer of DefaultSize.
+type SubscribeOptions struct {
+	// Name identifies the listener in the metrics.
+	Name string
+	// Size is the maximum number of queued updates.
+	Size   int
+	Policy Policy
+	// Prefixes limits the updates to params with these names or
+	// below, such as "pantilt" or "gps.fix".
+	Prefixes []string
+}
+
+// SubscriptionStats are the counters for one subscription.
+type SubscriptionStats struct {
+	Delivered int
+	Dropped   int
+	Coalesced int
+	// Queued is the number of updates waiting to be delivered.
+	Queued int
+}
+
+// Subscription delivers param updates to a listener.  Updates are
+// queued so that a slow listener never blocks Param.Set.
+type Subscription struct {
+	// C receives the updated params.
+	C <-chan *Param
+
+	params  *Params
+	options SubscribeOptions
+	out     chan<- *Param
+	owned   bool
+
+	mu    sync.Mutex
+	queue []*Param
+	// queued holds the params in the queue when coalescing.
+	queued map[*Param]bool
+	stats  SubscriptionStats
+
+	wake    chan bool
+	done    chan bool
+	stopped chan bool
+	once    sync.Once
+}
+
+// Subscribe creates a new subscription to updates in this group.
+func (ps *Params) Subscribe(options *SubscribeOptions) *Subscription {
+	return ps.subscribe(make(ParamChannel, 1), true, options)
+}
+
+// Listen to changes on any parameter in this group.  Updates are
+// coalesced and Set never blocks on l.
+func (ps *Params) Listen(l ParamChannel) *Subscription {
+	return ps.subscribe(l, false, nil)
+}
+
+func (ps *Params) subscribe(ch ParamChannel, owned bool, options *SubscribeOptions) *Subscription {
+	s := &Subscription{
+		C:       ch,
+		params:  ps,
+		out:     ch,
+		owned:   owned,
+		queued:  make(map[*Param]bool),
+		wake:    make(chan bool, 1),
+		done:    make(chan bool),
+		stopped: make(chan bool),
+	}
+	if options != nil {
+		s.options = *options
+	}
+	if s.options.Size <= 0 {
+		s.options.Size = DefaultSize
+	}
+
+	ps.mu.Lock()
+	ps.listeners = append(ps.listeners, s)
+	ps.mu.Unlock()
+
+	go s.run()
+	return s
+}
+
+// Unsubscribe stops delivering updates.  Queued updates are dropped.
+// Channels created by Subscribe are closed.
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		ps := s.params
+		ps.mu.Lock()
+		for i, l := range ps.listeners {
+			if l == s {
+				ps.listeners = append(ps.listeners[:i:i], ps.listeners[i+1:]...)
+				break
+			}
+		}
+		ps.mu.Unlock()
+
+		close(s.done)
+		<-s.stopped
+
+		if s.options.Name != "" {
+			listenerDelivered.DeleteLabelValues(s.options.Name)
+			listenerDropped.DeleteLabelValues(s.options.Name)
+			listenerCoalesced.DeleteLabelValues(s.options.Name)
+			listenerQueued.DeleteLabelValues(s.options.Name)
+		}
+	})
+}
+
+// Stats returns a snapshot of the counters.
+func (s *Subscription) Stats() SubscriptionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Queued = len(s.queue)
+	return stats
+}
+
+// wants returns true if the param matches the prefixes.
+func (s *Subscription) wants(p *Param) bool {
+	if len(s.options.Prefixes) == 0 {
+		return true
+	}
+	name := strings.ToLower(p.Name)
+	for _, prefix := range s.options.Prefixes {
+		prefix = strings.ToLower(prefix)
+		if name == prefix || strings.HasPrefix(name, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// push queues an update without blocking.
+func (s *Subscription) push(p *Param) {
+	if !s.wants(p) {
+		return
+	}
+
+	s.mu.Lock()
+	coalesced, dropped := false, false
+	if s.options.Policy == Coalesce && s.queued[p] {
+		s.stats.Coalesced++
+		coalesced = true
+	} else {
+		if len(s.queue) >= s.options.Size {
+			s.remove(0)
+			s.stats.Dropped++
+			dropped = true
+		}
+		s.queue = append(s.queue, p)
+		if s.options.Policy == Coalesce {
+			s.queued[p] = true
+		}
+	}
+	queued := len(s.queue)
+	s.mu.Unlock()
+
+	if name := s.options.Name; name != "" {
+		if coalesced {
+			listenerCoalesced.WithLabelValues(name).Inc()
+		}
+		if dropped {
+			listenerDropped.WithLabelValues(name).Inc()
+		}
+		listenerQueued.WithLabelValues(name).Set(float64(queued))
+	}
+
+	select {
+	case s.wake <- true:
+	default:
+	}
+}
+
+// remove drops the queued update at i.  Call with mu held.
+func (s *Subscription) remove(i int) {
+	p := s.queue[i]
+	s.queue = append(s.queue[:i], s.queue[i+1:]...)
+
+	if s.options.Policy == Coalesce {
+		delete(s.queued, p)
+	}
+}
+
+// pop returns the oldest update or nil if none.
+func (s *Subscription) pop() *Param {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 {
+		return nil
+	}
+	p := s.queue[0]
+	s.remove(0)
+	return p
+}
+
+// run delivers queued updates to the listener.
+func (s *Subscription) run() {
+	defer close(s.stopped)
+	if s.owned {
+		defer close(s.out)
+	}
+
+	for {
+		p := s.pop()
+		if p == nil {
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+
+		select {
+		case s.out <- p:
+			s.mu.Lock()
+			s.stats.Delivered++
+			queued := len(s.queue)
+			s.mu.Unlock()
+
+			if name := s.options.Name; name != "" {
+				listenerDelivered.WithLabelValues(name).Inc()
+				listenerQueued.WithLabelValues(name).Set(float64(queued))
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// receive returns the next update or nil after a timeout.
+func receive(sub *Subscription) *Param {
+	select {
+	case p := <-sub.C:
+		return p
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+// stall takes the first update so that later ones queue up.
+func stall(t *testing.T, sub *Subscription, p *Param) {
+	p.Inc()
+	assert.Equal(t, receive(sub), p)
+	// The next update is held in the channel buffer.
+	p.Inc()
+	for sub.Stats().Queued != 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSubscribeCoalesce(t *testing.T) {
+	ps := &Params{Name: "root"}
+	a := ps.NewNum("a")
+	b := ps.NewNum("b")
+
+	sub := ps.Subscribe(&SubscribeOptions{Size: 2})
+	defer sub.Unsubscribe()
+	stall(t, sub, a)
+
+	// Never blocks.
+	for i := 0; i < 100; i++ {
+		a.Inc()
+		b.Inc()
+	}
+
+	stats := sub.Stats()
+	assert.Equal(t, stats.Queued, 2)
+	assert.Equal(t, stats.Coalesced, 198)
+	assert.Equal(t, stats.Dropped, 0)
+
+	assert.Equal(t, receive(sub), a)
+	assert.Equal(t, receive(sub), a)
+	assert.Equal(t, receive(sub), b)
+	assert.Equal(t, b.GetInt(), 100)
+}
+
+func TestSubscribeDropOldest(t *testing.T) {
+	ps := &Params{Name: "root"}
+	a := ps.NewNum("a")
+	b := ps.NewNum("b")
+
+	sub := ps.Subscribe(&SubscribeOptions{Name: "test", Size: 3, Policy: DropOldest})
+	defer sub.Unsubscribe()
+	stall(t, sub, a)
+
+	a.Inc()
+	b.Inc()
+	a.Inc()
+	b.Inc()
+
+	stats := sub.Stats()
+	assert.Equal(t, stats.Queued, 3)
+	assert.Equal(t, stats.Dropped, 1)
+
+	// Channel buffer then b, a, b.
+	assert.Equal(t, receive(sub), a)
+	assert.Equal(t, receive(sub), b)
+	assert.Equal(t, receive(sub), a)
+	assert.Equal(t, receive(sub), b)
+}
+
+func TestSubscribePrefix(t *testing.T) {
+	ps := &Params{Name: "root"}
+	pan := ps.NewNum("pantilt.pan")
+	ps.NewNum("pantilts")
+	gps := ps.NewNum("gps")
+
+	sub := ps.Subscribe(&SubscribeOptions{Prefixes: []string{"PanTilt", "gps"}})
+	defer sub.Unsubscribe()
+
+	for _, p := range ps.All() {
+		p.Inc()
+	}
+	assert.Equal(t, receive(sub), pan)
+	assert.Equal(t, receive(sub), gps)
+}
+
+func TestUnsubscribe(t *testing.T) {
+	ps := &Params{Name: "root"}
+	a := ps.NewNum("a")
+
+	sub := ps.Subscribe(nil)
+	a.Inc()
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+
+	// The channel is closed after any buffered update.
+	for range sub.C {
+	}
+	a.Inc()
+	assert.Equal(t, sub.Stats().Queued, 0)
+}
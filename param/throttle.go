@@ -0,0 +1,187 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is the minimum time between publishes to one topic
+// if none is configured.
+const DefaultInterval = 200 * time.Millisecond
+
+// pendingPublish is the latest value for a topic that arrived too
+// soon after the last publish.
+type pendingPublish struct {
+	payload  []byte
+	value    interface{}
+	retained bool
+	timer    *time.Timer
+}
+
+// throttle limits how often each topic is published.  An update that
+// arrives inside the interval is held and the latest one is published
+// when the interval expires, so the final value is never lost.
+// Numbers that are within the deadband of the last published value
+// are dropped.
+type throttle struct {
+	publish func(topic string, payload []byte, retained bool)
+
+	mu sync.Mutex
+	// interval and deadband map a dotted param or leaf name to its
+	// setting.  The closest parent is used if a leaf isn't listed.
+	interval map[string]time.Duration
+	deadband map[string]float64
+	fallback time.Duration
+
+	last    map[string]time.Time
+	sent    map[string]interface{}
+	pending map[string]*pendingPublish
+}
+
+func newThrottle(fallback time.Duration, publish func(topic string, payload []byte, retained bool)) *throttle {
+	if fallback <= 0 {
+		fallback = DefaultInterval
+	}
+	return &throttle{
+		publish:  publish,
+		interval: make(map[string]time.Duration),
+		deadband: make(map[string]float64),
+		fallback: fallback,
+		last:     make(map[string]time.Time),
+		sent:     make(map[string]interface{}),
+		pending:  make(map[string]*pendingPublish),
+	}
+}
+
+// lookup finds the closest setting for name or its parents.
+func lookup(name string, find func(name string) bool) bool {
+	for {
+		if find(name) {
+			return true
+		}
+		dot := strings.LastIndex(name, ".")
+		if dot < 0 {
+			return false
+		}
+		name = name[:dot]
+	}
+}
+
+func (t *throttle) intervalOf(name string) time.Duration {
+	interval := t.fallback
+	lookup(name, func(name string) bool {
+		i, ok := t.interval[name]
+		if ok {
+			interval = i
+		}
+		return ok
+	})
+	return interval
+}
+
+func (t *throttle) deadbandOf(name string) float64 {
+	deadband := 0.0
+	lookup(name, func(name string) bool {
+		d, ok := t.deadband[name]
+		if ok {
+			deadband = d
+		}
+		return ok
+	})
+	return deadband
+}
+
+// inDeadband returns true if value is a number close to the last
+// published value.
+func (t *throttle) inDeadband(topic, name string, value interface{}) bool {
+	deadband := t.deadbandOf(name)
+	if deadband <= 0 {
+		return false
+	}
+	next, err := asNumber(value)
+	if err != nil {
+		return false
+	}
+	sent, err := asNumber(t.sent[topic])
+	if err != nil {
+		return false
+	}
+	return math.Abs(next-sent) < deadband
+}
+
+// configure replaces the per name settings.
+func (t *throttle) configure(interval map[string]time.Duration, deadband map[string]float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.interval, t.deadband = interval, deadband
+}
+
+// push publishes now, holds the update until the interval expires, or
+// drops it if inside the deadband.  name is the dotted name used to
+// find the settings and value is used for the deadband.  Forced
+// updates are always published now.
+func (t *throttle) push(topic, name string, payload []byte, value interface{}, retained, force bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	name = strings.ToLower(name)
+
+	if !force && t.inDeadband(topic, name, value) {
+		if p := t.pending[topic]; p != nil {
+			p.timer.Stop()
+			delete(t.pending, topic)
+		}
+		return
+	}
+
+	now := time.Now()
+	wait := t.last[topic].Add(t.intervalOf(name)).Sub(now)
+	if force || wait <= 0 {
+		if p := t.pending[topic]; p != nil {
+			p.timer.Stop()
+			delete(t.pending, topic)
+		}
+		t.send(topic, payload, value, retained, now)
+		return
+	}
+
+	if p := t.pending[topic]; p != nil {
+		p.payload, p.value, p.retained = payload, value, retained
+		return
+	}
+	p := &pendingPublish{payload: payload, value: value, retained: retained}
+	p.timer = time.AfterFunc(wait, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.pending[topic] != p {
+			return
+		}
+		delete(t.pending, topic)
+		t.send(topic, p.payload, p.value, p.retained, time.Now())
+	})
+	t.pending[topic] = p
+}
+
+// send publishes with mu held.
+func (t *throttle) send(topic string, payload []byte, value interface{}, retained bool, now time.Time) {
+	t.last[topic] = now
+	t.sent[topic] = value
+	t.publish(topic, payload, retained)
+}
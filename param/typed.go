@@ -0,0 +1,47 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+// Num is a param that holds a number.  The getters never panic.
+type Num struct {
+	*Param
+}
+
+// Value returns the number, and false if the param is unset or not a
+// number.
+func (n Num) Value() (float64, bool) {
+	f, err := asNumber(n.Get())
+	return f, err == nil
+}
+
+// Int returns the number as an int, and false if the param is unset
+// or not a number.
+func (n Num) Int() (int, bool) {
+	f, ok := n.Value()
+	return int(f), ok
+}
+
+// Str is a param that holds a string.  The getters never panic.
+type Str struct {
+	*Param
+}
+
+// Value returns the string, and false if the param is unset or not a
+// string.
+func (s Str) Value() (string, bool) {
+	v, ok := s.Get().(string)
+	return v, ok
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package param
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTyped(t *testing.T) {
+	ps := &Params{Name: "root"}
+	num := Num{ps.New("num")}
+	str := Str{ps.New("str")}
+
+	// Unset values are not ok.
+	_, ok := num.Value()
+	assert.False(t, ok)
+	_, ok = str.Value()
+	assert.False(t, ok)
+	assert.Equal(t, num.GetFloat64(), 0.0)
+
+	num.SetInt(3)
+	i, ok := num.Int()
+	assert.True(t, ok)
+	assert.Equal(t, i, 3)
+
+	str.Set("texty")
+	s, ok := str.Value()
+	assert.True(t, ok)
+	assert.Equal(t, s, "texty")
+
+	// Wrong types are not ok and don't panic.
+	wrong := Num{ps.NewWith("wrong", "texty")}
+	_, ok = wrong.Value()
+	assert.False(t, ok)
+	assert.Equal(t, wrong.GetInt(), 0)
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"fmt"
+	"log"
+)
+
+const (
+	// maxSpokenSpeed is the highest speed in kph that has a
+	// pre-rendered phrase.
+	maxSpokenSpeed = 150
+)
+
+// fixedPhrases are the announcements that aren't made by an
+// announce rule.
+var fixedPhrases = []string{
+	"Base ready",
+	"Save failed",
+	"Saved",
+}
+
+// speedPhrase returns the announcement for a speed in kph.
+func speedPhrase(kph float64) string {
+	return fmt.Sprintf("%.0f kph", kph)
+}
+
+// Phrases returns every phrase that pipoint can say with the built in
+// rules plus the given announce rules, so that they can be rendered
+// ahead of time.
+func Phrases(rules map[string]*AnnounceRule) []string {
+	announcer := NewAnnouncer(nil, nil)
+	if err := announcer.Configure(rules); err != nil {
+		log.Printf("%v\n", err)
+	}
+
+	var phrases []string
+	phrases = append(phrases, fixedPhrases...)
+	phrases = append(phrases, announcer.Phrases()...)
+	phrases = append(phrases, stateNames()...)
+	for kph := 2; kph <= maxSpokenSpeed; kph++ {
+		phrases = append(phrases, speedPhrase(float64(kph)))
+	}
+	for percent := 0; percent <= 100; percent++ {
+		phrases = append(phrases, fmt.Sprintf("Battery %d percent", percent))
+	}
+	for _, s := range sensors {
+		phrases = append(phrases, s.spoken+" failed")
+	}
+
+	// A configured rule may say the same as a built in one.
+	var unique []string
+	seen := make(map[string]bool)
+	for _, text := range phrases {
+		if !seen[text] {
+			seen[text] = true
+			unique = append(unique, text)
+		}
+	}
+	return unique
+}
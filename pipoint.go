@@ -16,18 +16,24 @@
 package pipoint
 
 import (
+	"fmt"
 	"log"
+	"math"
 	"time"
 
 	"juju.nz/x/pipoint/param"
 	"juju.nz/x/pipoint/util"
 
 	common "gobot.io/x/gobot/platforms/mavlink/common"
-	"gobot.io/x/gobot/platforms/mqtt"
 )
 
 const (
 	dt = time.Millisecond * 20
+	// gpsMaxAge is how long GPS based positions stay valid.
+	gpsMaxAge = 2 * time.Second
+	// validityBuffer is the number of validity changes queued
+	// for the main loop.
+	validityBuffer = 100
 )
 
 var (
@@ -42,6 +48,36 @@ type State interface {
 	Update(param *param.Param)
 }
 
+// ValidityHandler is implemented by states that react to a param
+// becoming valid or going stale.
+type ValidityHandler interface {
+	Validity(param *param.Param, ok bool)
+}
+
+// validityEvent is a param becoming valid or going stale.
+type validityEvent struct {
+	param *param.Param
+	ok    bool
+}
+
+// neuMeta describes a NEUPosition param.
+var neuMeta = &param.Meta{
+	Leaves: map[string]*param.Meta{
+		"north": {Unit: "m"},
+		"east":  {Unit: "m"},
+		"up":    {Unit: "m"},
+	},
+}
+
+// attitudeMeta describes an Attitude param.
+var attitudeMeta = &param.Meta{
+	Leaves: map[string]*param.Meta{
+		"roll":  {Unit: "rad"},
+		"pitch": {Unit: "rad"},
+		"yaw":   {Unit: "rad"},
+	},
+}
+
 // PiPoint is an automatic, GPS based system that points a camera at the rover.
 type PiPoint struct {
 	Params *param.Params
@@ -54,24 +90,39 @@ type PiPoint struct {
 	messages   *param.Param
 	heartbeats *param.Param
 	heartbeat  *param.Param
-	attitude   *param.Param
-	gps        *param.Param
+	attitude   AttitudeParam
+	gps        PositionParam
 	gpsFix     *param.Param
-	neu        *param.Param
-	baseOffset *param.Param
-	pred       *param.Param
-	rover      *param.Param
-	base       *param.Param
+	neu        NEUPositionParam
+	baseOffset NEUPositionParam
+	pred       PositionParam
+	rover      NEUPositionParam
+	base       NEUPositionParam
 	sysStatus  *param.Param
+	sensors    *param.Param
+	failed     *param.Param
+	satellites *param.Param
 	link       *param.Param
-	linkLast   int
 	remote     *param.Param
 	command    *param.Param
 	mark       *param.Param
+	save       *param.Param
 	vel        *param.Param
+	group      param.Str
+	target     param.Num
+	mute       param.Num
+	volume     param.Num
+
+	batteryVoltage   *param.Param
+	batteryCurrent   *param.Param
+	batteryRemaining *param.Param
+
+	relative RelativeParam
+	lens     LensParam
+	zoom     *param.Param
 
-	sp     *param.Param
-	offset *param.Param
+	sp     AttitudeParam
+	offset AttitudeParam
 
 	pan  *Servo
 	tilt *Servo
@@ -81,91 +132,232 @@ type PiPoint struct {
 	altPred *LinPred
 
 	states []State
+	// baseLoaded is true if base.position was loaded from the config
+	// at startup, in which case Locate keeps it.
+	baseLoaded bool
 
-	elog *EventLogger
-	log  *log.Logger
+	elog      *EventLogger
+	log       *log.Logger
+	logFilter *LogFilter
 
-	param param.ParamChannel
+	param    <-chan *param.Param
+	validity chan *validityEvent
 
-	audio *AudioOut
+	audio     *AudioOut
+	announcer *Announcer
 }
 
-// NewPiPoint creates a new camera pointer.
-func NewPiPoint() *PiPoint {
-	p := &PiPoint{
-		Params:  param.NewParams("pipoint"),
-		latPred: &LinPred{},
-		lonPred: &LinPred{},
-		altPred: &LinPred{},
-		elog:    NewEventLogger("pipoint"),
-		param:   make(param.ParamChannel, 10),
-		audio:   NewAudioOut(),
+// newStates creates all states in state param order.
+func newStates(pi *PiPoint) []State {
+	return []State{
+		&LocateState{pi: pi},
+		&OrientateState{pi: pi},
+		&RunState{pi: pi},
+		&HoldState{pi: pi},
+		&CycleState{pi: pi},
 	}
+}
 
-	p.log = p.elog.logger
-
-	p.states = []State{
-		&LocateState{pi: p},
-		&OrientateState{pi: p},
-		&RunState{pi: p},
-		&HoldState{pi: p},
-		&CycleState{pi: p},
+// stateNames returns the names of all states in state param order.
+func stateNames() []string {
+	var names []string
+	for _, state := range newStates(nil) {
+		names = append(names, state.Name())
 	}
+	return names
+}
 
-	p.link = p.Params.NewNum("link.status")
-	p.remote = p.Params.New("remote")
-	p.command = p.Params.NewNum("command")
-	p.mark = p.Params.NewNum("mark")
-
-	p.version = p.Params.NewWith("build_label", Version)
-	p.tick = p.Params.NewNum("tick")
-	p.seconds = p.Params.NewNum("tick")
-	p.messages = p.Params.NewNum("rover.messages")
-
-	p.state = p.Params.NewNum("state")
-	p.heartbeat = p.Params.NewWith("heartbeat", &common.Heartbeat{})
-	p.heartbeats = p.Params.NewNum("heartbeat")
-
-	p.gps = p.Params.New("gps")
-	p.gpsFix = p.Params.NewNum("gps.fix")
-	p.vel = p.Params.NewNum("gps.vog")
-	p.neu = p.Params.New("position")
-	p.pred = p.Params.New("pred")
+// stateName returns the name of the given state number.
+func stateName(state int) string {
+	states := newStates(nil)
+	if state >= 0 && state < len(states) {
+		return states[state].Name()
+	}
+	return fmt.Sprintf("State %d", state)
+}
 
-	p.attitude = p.Params.New("rover.attitude")
-	p.rover = p.Params.New("rover.position")
-	p.base = p.Params.New("base.position")
-	p.baseOffset = p.Params.NewWith("base.offset", &NEUPosition{})
+// NewPiPoint creates a new camera pointer.
+func NewPiPoint() *PiPoint {
+	p := &PiPoint{
+		Params:    param.NewParams("pipoint"),
+		latPred:   &LinPred{},
+		lonPred:   &LinPred{},
+		altPred:   &LinPred{},
+		audio:     NewAudioOut(NewALSABackend("default")),
+		logFilter: NewLogFilter(),
+		validity:  make(chan *validityEvent, validityBuffer),
+	}
 
-	p.sysStatus = p.Params.New("rover.status")
+	p.elog = NewEventLogger("pipoint", p.Params)
+	p.log = p.elog.logger
 
-	p.sp = p.Params.NewWith("pantilt.sp", &Attitude{})
-	p.offset = p.Params.NewWith("pantilt.offset", &Attitude{})
+	p.states = newStates(p)
+
+	readOnly := &param.Meta{ReadOnly: true}
+
+	p.link = p.Params.NewNum("link.status", &param.Meta{
+		Description: "Rover link",
+		Enum:        []string{"Unknown", "Online", "Offline"},
+		ReadOnly:    true,
+	})
+	p.remote = p.Params.New("remote", &param.Meta{ReadOnly: true, MaxAge: time.Second})
+	p.command = p.Params.NewNum("command", readOnly)
+	p.mark = p.Params.NewNum("mark", &param.Meta{Description: "Set to advance the state", Action: true})
+	p.save = p.Params.NewNum("save", &param.Meta{Description: "Set to save the config", Action: true})
+
+	p.group = param.Str{Param: p.Params.NewWith("group", "", &param.Meta{
+		Description: "Group used by the controller",
+		Retain:      true,
+	})}
+	p.group.Persist()
+	p.target = param.Num{Param: p.Params.NewNum("rover.target", &param.Meta{
+		Description: "MAVLink system ID of the rover to follow, or 0 for any",
+		Min:         0,
+		Max:         255,
+		Retain:      true,
+	})}
+	p.target.Persist()
+
+	p.mute = param.Num{Param: p.Params.NewNum("audio.mute", &param.Meta{
+		Description: "Set to stop announcements",
+		Min:         0,
+		Max:         1,
+		Retain:      true,
+	})}
+	p.mute.Persist()
+	p.volume = param.Num{Param: p.Params.NewWith("audio.volume", 100.0, &param.Meta{
+		Description: "Announcement volume",
+		Unit:        "%",
+		Min:         0,
+		Max:         100,
+		Retain:      true,
+	})}
+	p.volume.Persist()
+
+	p.version = p.Params.NewWith("build_label", Version, &param.Meta{ReadOnly: true, Retain: true})
+	p.tick = p.Params.NewNum("tick", &param.Meta{Unit: "s", ReadOnly: true})
+	p.seconds = p.Params.NewNum("seconds", &param.Meta{Unit: "s", ReadOnly: true})
+	p.messages = p.Params.NewNum("rover.messages", &param.Meta{
+		Description: "MAVLink messages received", ReadOnly: true, Counter: true,
+	})
+
+	p.state = p.Params.NewNum("state", &param.Meta{
+		Description: "Current state",
+		Enum:        stateNames(),
+		Retain:      true,
+	})
+	p.heartbeat = p.Params.NewWith("heartbeat", &common.Heartbeat{}, readOnly)
+	p.heartbeats = p.Params.NewNum("rover.heartbeats", &param.Meta{
+		Description: "MAVLink heartbeats received", ReadOnly: true, Counter: true,
+	})
+
+	gpsMeta := &param.Meta{ReadOnly: true, MaxAge: gpsMaxAge}
+
+	p.gps = PositionParam{p.Params.NewTyped("gps", (*Position)(nil), gpsMeta)}
+	p.gpsFix = p.Params.NewNum("gps.fix", &param.Meta{Description: "GPS fix type", ReadOnly: true, History: 100})
+	p.satellites = p.Params.NewNum("gps.satellites", &param.Meta{Description: "GPS satellites visible", ReadOnly: true})
+	p.vel = p.Params.NewNum("gps.vog", &param.Meta{Description: "Rover speed", Unit: "m/s", ReadOnly: true})
+	p.neu = NEUPositionParam{p.Params.NewTyped("position", (*NEUPosition)(nil), gpsMeta)}
+	p.pred = PositionParam{p.Params.NewTyped("pred", (*Position)(nil), readOnly)}
+
+	p.attitude = AttitudeParam{p.Params.NewTyped("rover.attitude", (*Attitude)(nil), &param.Meta{ReadOnly: true, MaxAge: time.Second})}
+	p.rover = NEUPositionParam{p.Params.NewTyped("rover.position", (*NEUPosition)(nil), gpsMeta)}
+	p.base = NEUPositionParam{p.Params.NewTyped("base.position", &NEUPosition{}, neuMeta)}
+	p.base.Persist()
+	p.baseOffset = NEUPositionParam{p.Params.NewWith("base.offset", &NEUPosition{}, neuMeta)}
+	p.baseOffset.Persist()
+
+	p.sysStatus = p.Params.New("rover.status", &param.Meta{ReadOnly: true, MaxAge: 5 * time.Second})
+	p.batteryVoltage = p.Params.NewNum("rover.battery.voltage", &param.Meta{
+		Description: "Rover battery voltage", Unit: "V", ReadOnly: true, MaxAge: 5 * time.Second,
+	})
+	p.batteryCurrent = p.Params.NewNum("rover.battery.current", &param.Meta{
+		Description: "Rover battery current", Unit: "A", ReadOnly: true, MaxAge: 5 * time.Second,
+	})
+	p.batteryRemaining = p.Params.NewNum("rover.battery.remaining", &param.Meta{
+		Description: "Rover battery remaining", Unit: "%", ReadOnly: true, MaxAge: 5 * time.Second,
+	})
+	p.sensors = p.Params.NewWith("rover.sensors", map[string]bool{}, &param.Meta{
+		Description: "Health of each enabled rover sensor",
+		ReadOnly:    true,
+		MaxAge:      5 * time.Second,
+		Leaves:      map[string]*param.Meta{"*": {Description: "Sensor is healthy"}},
+	})
+	p.failed = p.Params.NewWith("rover.failed", "", &param.Meta{
+		Description: "Enabled rover sensors that are unhealthy",
+		ReadOnly:    true,
+		Retain:      true,
+	})
+
+	p.relative = RelativeParam{p.Params.NewTyped("rover.relative", (*Relative)(nil), relativeMeta)}
+	p.lens = LensParam{p.Params.NewWith("camera.lens", &Lens{Range: 50, MaxZoom: 1}, lensMeta)}
+	p.lens.Persist()
+	p.zoom = p.Params.NewNum("camera.zoom", &param.Meta{
+		Description: "Zoom that keeps the rover the same size",
+		ReadOnly:    true,
+	})
+
+	p.sp = AttitudeParam{p.Params.NewWith("pantilt.sp", &Attitude{}, readOnly)}
+	p.offset = AttitudeParam{p.Params.NewWith("pantilt.offset", &Attitude{}, attitudeMeta)}
+	p.offset.Persist()
 
 	p.pan = NewServo("pantilt.pan", p.Params)
 	p.tilt = NewServo("pantilt.tilt", p.Params)
 
-	p.Params.Listen(p.param)
+	p.announcer = NewAnnouncer(p.Params, p.audio)
+
+	p.param = p.Params.Subscribe(&param.SubscribeOptions{Name: "main"}).C
+	p.Params.OnLoad(p.loaded)
+	p.Params.OnValidity(p.queueValidity)
 	p.Params.Load()
+	p.baseLoaded = p.base.Ok()
 	return p
 }
 
+// loaded is called when the config has been (re)loaded.
+func (pi *PiPoint) loaded(params *param.Params) {
+	var filter map[string]interface{}
+	if err := params.Unmarshal("elog.filter", &filter); err != nil {
+		log.Printf("elog.filter: %v\n", err)
+	}
+	if err := pi.logFilter.Configure(filter); err != nil {
+		log.Printf("elog.filter: %v\n", err)
+	}
+
+	var rules map[string]*AnnounceRule
+	if err := params.Unmarshal("announce", &rules); err != nil {
+		log.Printf("announce: %v\n", err)
+	}
+	if err := pi.announcer.Configure(rules); err != nil {
+		log.Printf("%v\n", err)
+	}
+}
+
 // AddMQTT adds a new MQTT connection that bridges between MQTT and
 // params.
-func (pi *PiPoint) AddMQTT(mqtt *mqtt.Adaptor) {
-	param.NewParamMQTTBridge(pi.Params, mqtt, "")
+func (pi *PiPoint) AddMQTT(options *param.MQTTOptions) error {
+	options.BuildLabel = Version
+	_, err := param.NewParamMQTTBridge(pi.Params, options)
+	return err
+}
+
+// SetAudioBackend changes how announcements are played.
+func (pi *PiPoint) SetAudioBackend(backend AudioBackend) {
+	pi.audio.SetBackend(backend)
 }
 
 // Run is the main entry point that runs forever.
 func (pi *PiPoint) Run() {
 	tick := time.NewTicker(dt)
 
-	pi.audio.Say("Base ready")
+	pi.audio.Say(PriorityState, "Base ready")
 
 	for {
 		select {
 		case param := <-pi.param:
 			pi.update(param)
+		case e := <-pi.validity:
+			pi.validated(e.param, e.ok)
 		case <-tick.C:
 			pi.ticked()
 		}
@@ -177,10 +369,6 @@ func (pi *PiPoint) ticked() {
 	pi.tick.SetFloat64(now)
 	pi.seconds.UpdateInt(int(now))
 
-	if !pi.heartbeat.Ok() {
-		pi.link.UpdateInt(2)
-	}
-
 	pred := &Position{
 		Time: now,
 		Lat:  pi.latPred.GetEx(now),
@@ -207,8 +395,57 @@ func (pi *PiPoint) update(param *param.Param) {
 		state.Update(param)
 	}
 
+	if param == pi.neu.Param {
+		pi.updateRelative()
+	}
+
+	if param == pi.save {
+		pi.saveParams()
+	}
+
 	pi.announce(param)
-	pi.log.Printf("%s %T %#v\n", param.Name, param.Get(), param.Get())
+
+	entry := fmt.Sprintf("%T %#v", param.Get(), param.Get())
+	if pi.logFilter.Check(param.Name, entry) {
+		pi.log.Printf("%s %s\n", param.Name, entry)
+	}
+}
+
+// queueValidity passes validity changes from any goroutine to the main
+// loop.
+func (pi *PiPoint) queueValidity(param *param.Param, ok bool) {
+	select {
+	case pi.validity <- &validityEvent{param, ok}:
+	default:
+		log.Printf("validity: dropped %s\n", param.Name)
+	}
+}
+
+// validated is called when a param becomes valid or goes stale.
+func (pi *PiPoint) validated(param *param.Param, ok bool) {
+	pi.log.Printf("%s.ok %T %#v\n", param.Name, ok, ok)
+
+	if param == pi.heartbeat && !ok {
+		pi.link.UpdateInt(2)
+	}
+
+	pi.announcer.Validity(param, ok, pi.currentState())
+
+	if handler, isHandler := pi.getState().(ValidityHandler); isHandler {
+		handler.Validity(param, ok)
+	}
+}
+
+// saveParams writes the persistent params such as the base position
+// and offsets back to the config.
+func (pi *PiPoint) saveParams() {
+	if err := pi.Params.Save(); err != nil {
+		log.Printf("save: %v\n", err)
+		pi.log.Printf("save: %v\n", err)
+		pi.audio.Say(PrioritySafety, "Save failed")
+		return
+	}
+	pi.audio.Say(PriorityState, "Saved")
 }
 
 func (pi *PiPoint) getState() State {
@@ -219,30 +456,46 @@ func (pi *PiPoint) getState() State {
 	return nil
 }
 
+// currentState returns the name of the current state, or "" if none.
+func (pi *PiPoint) currentState() string {
+	if state := pi.getState(); state != nil {
+		return state.Name()
+	}
+	return ""
+}
+
 func (pi *PiPoint) announce(param *param.Param) {
+	pi.announcer.Update(param, pi.currentState())
+
 	switch param {
-	case pi.state:
-		if state := pi.getState(); state != nil {
-			pi.audio.Say(state.Name())
-		}
-	case pi.link:
-		link := param.GetInt()
-		if link != pi.linkLast {
-			pi.linkLast = link
-			switch link {
-			case 1:
-				pi.audio.Say("Rover ready")
-			case 2:
-				pi.audio.Say("Rover offline")
-			}
-		}
-	case pi.gpsFix:
-		if param.GetInt() >= 3 {
-			pi.audio.Say("GPS ready")
+	case pi.mute.Param:
+		muted, _ := pi.mute.Int()
+		pi.audio.SetMute(muted != 0)
+	case pi.volume.Param:
+		if volume, ok := pi.volume.Value(); ok {
+			pi.audio.SetVolume(volume)
 		}
 	}
 }
 
+// Packet handles a MAVLink packet, dropping any that aren't from the
+// target rover.
+func (pi *PiPoint) Packet(data interface{}) {
+	packet, ok := data.(*common.MAVLinkPacket)
+	if !ok {
+		return
+	}
+	if target, _ := pi.target.Int(); target != 0 && int(packet.SystemID) != target {
+		return
+	}
+	msg, err := packet.MAVLinkMessage()
+	if err != nil {
+		pi.log.Printf("%s %v\n", "packet", err)
+		return
+	}
+	pi.Message(msg)
+}
+
 // Message handles a MAVLink message.
 func (pi *PiPoint) Message(msg interface{}) {
 	switch msg.(type) {
@@ -251,19 +504,25 @@ func (pi *PiPoint) Message(msg interface{}) {
 		pi.heartbeats.Inc()
 		pi.heartbeat.Set(msg.(*common.Heartbeat))
 	case *common.SysStatus:
-		pi.sysStatus.Set(msg.(*common.SysStatus))
+		status := msg.(*common.SysStatus)
+		pi.sysStatus.Set(status)
+		pi.updateSysStatus(status)
 	case *common.GpsRawInt:
 		gps := msg.(*common.GpsRawInt)
-		pi.gps.Set(&Position{
+		position := &Position{
 			Time:    float64(gps.TIME_USEC) * 1e-6,
 			Lat:     float64(gps.LAT) * 1e-7,
 			Lon:     float64(gps.LON) * 1e-7,
 			Alt:     float64(gps.ALT) * 1e-3,
 			Heading: float64(gps.COG) * 1e-2,
-		})
-		pi.neu.Set(pi.gps.Get().(*Position).ToNEU())
+		}
+		pi.gps.Set(position)
+		pi.neu.Set(position.ToNEU())
 		pi.vel.SetFloat64(float64(gps.VEL) * 1e-2)
 		pi.gpsFix.UpdateInt(int(gps.FIX_TYPE))
+		if gps.SATELLITES_VISIBLE != math.MaxUint8 {
+			pi.satellites.UpdateInt(int(gps.SATELLITES_VISIBLE))
+		}
 	case *common.Attitude:
 		att := msg.(*common.Attitude)
 		pi.attitude.Set(&Attitude{
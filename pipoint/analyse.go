@@ -0,0 +1,143 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"juju.nz/x/pipoint/analyse"
+)
+
+// analyseMain summarises event logs, or the recorded history of a
+// running pipoint, and writes the time series and a report.
+func analyseMain(args []string) {
+	fs := flag.NewFlagSet("analyse", flag.ExitOnError)
+	out := fs.String("o", ".", "Directory to write the series and report.html to")
+	url := fs.String("url", "", "Fetch the history of the named params from this pipoint, such as http://pipoint:3000")
+	since := fs.String("since", "5m", "How much history to fetch")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		log.Fatalln("Usage: pipoint analyse [-o dir] pipoint-*.txt.gz...\n" +
+			"       pipoint analyse [-o dir] -url http://pipoint:3000 [-since 5m] param...")
+	}
+
+	var events []*analyse.Event
+	var err error
+	if *url != "" {
+		events, err = fetchHistory(*url, *since, fs.Args())
+	} else {
+		events, err = analyse.ParseFiles(fs.Args())
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(events) == 0 {
+		log.Fatalln("No events found")
+	}
+
+	all := analyse.Collect(events)
+	summary := analyse.Summarise(events)
+	summary.Write(os.Stdout)
+
+	if err := os.MkdirAll(*out, 0777); err != nil {
+		log.Fatalln(err)
+	}
+
+	csv, err := os.Create(filepath.Join(*out, "series.csv"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer csv.Close()
+	if err := analyse.WriteCSV(csv, summary.Start, all); err != nil {
+		log.Fatalln(err)
+	}
+
+	parquet, err := os.Create(filepath.Join(*out, "series.parquet"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer parquet.Close()
+	if err := analyse.WriteParquet(parquet, summary.Start, all); err != nil {
+		log.Fatalln(err)
+	}
+
+	if err := writeSeries(filepath.Join(*out, "series"), summary.Start, all); err != nil {
+		log.Fatalln(err)
+	}
+
+	report, err := os.Create(filepath.Join(*out, "report.html"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer report.Close()
+	if err := analyse.WriteReport(report, summary, all); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// writeSeries writes each series to its own CSV file in dir, such as
+// dir/pantilt.pan.sp.csv.
+func writeSeries(dir string, start time.Time, all map[string]*analyse.Series) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	for _, name := range analyse.Names(all) {
+		f, err := os.Create(filepath.Join(dir, strings.Replace(name, "/", "_", -1)+".csv"))
+		if err != nil {
+			return err
+		}
+		err = analyse.WriteSeriesCSV(f, start, all[name])
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchHistory reads the recorded history of the named params.
+func fetchHistory(url, since string, names []string) ([]*analyse.Event, error) {
+	var lists [][]*analyse.Event
+	for _, name := range names {
+		path := fmt.Sprintf("%s/params/%s?history=%s", strings.TrimRight(url, "/"),
+			strings.Replace(name, ".", "/", -1), since)
+		resp, err := http.Get(path)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%v: %v", name, resp.Status)
+		}
+		events, err := analyse.ParseHistory(resp.Body, name)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, events)
+	}
+	return analyse.Merge(lists...), nil
+}
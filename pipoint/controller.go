@@ -0,0 +1,133 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"juju.nz/x/pipoint/param"
+)
+
+const controllerHelp = `Commands:
+  list                      Show all bases
+  mark [target]             Advance the state
+  state <state> [target]    Change the state, such as Run or 2
+  rover <id> [target]       Follow the rover with this MAVLink system ID
+  set <param> <value> [target]
+  quit
+The target is all, a group, or a base.  The default is all.
+`
+
+// controllerMain shows all bases on the MQTT server and sends
+// commands to them.
+func controllerMain(args []string, options *param.MQTTOptions) {
+	fs := flag.NewFlagSet("controller", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 3*time.Second, "How long to wait for each base to acknowledge")
+	fs.Parse(args)
+
+	if options.URL == "" {
+		log.Fatalln("Usage: pipoint -mqtt.url tls://host:8883 controller [-timeout 3s]")
+	}
+
+	c, err := param.NewController("pipoint", options)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Print(controllerHelp)
+	scanner := bufio.NewScanner(os.Stdin)
+	for fmt.Print("> "); scanner.Scan(); fmt.Print("> ") {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+
+		var name, value string
+		rest := words[1:]
+		switch words[0] {
+		case "list":
+			list(c.Bases())
+			continue
+		case "quit":
+			return
+		case "mark":
+			name, value = "mark", "1"
+		case "state", "rover":
+			if len(rest) == 0 {
+				fmt.Print(controllerHelp)
+				continue
+			}
+			name = map[string]string{"state": "state", "rover": "rover.target"}[words[0]]
+			value, rest = rest[0], rest[1:]
+		case "set":
+			if len(rest) < 2 {
+				fmt.Print(controllerHelp)
+				continue
+			}
+			name, value, rest = rest[0], rest[1], rest[2:]
+		default:
+			fmt.Print(controllerHelp)
+			continue
+		}
+
+		target := "all"
+		if len(rest) != 0 {
+			target = rest[0]
+		}
+		results, err := c.Set(target, name, value, *timeout)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		var devices []string
+		for device := range results {
+			devices = append(devices, device)
+		}
+		sort.Strings(devices)
+		for _, device := range devices {
+			if err := results[device]; err != nil {
+				fmt.Printf("%s: %v\n", device, err)
+			} else {
+				fmt.Printf("%s: ok\n", device)
+			}
+		}
+	}
+}
+
+// list prints a table of the bases.
+func list(bases []*param.Base) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "BASE\tSTATUS\tGROUP\tSTATE\tLINK\tFIX\tROVER\tBUILD")
+	for _, b := range bases {
+		status := "offline"
+		if b.Online {
+			status = "online"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			b.Device, status, b.Format("group"), b.Format("state"),
+			b.Format("link.status"), b.Format("gps.fix"),
+			b.Format("rover.target"), b.Format("$build_label"))
+	}
+	w.Flush()
+}
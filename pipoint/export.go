@@ -0,0 +1,69 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"juju.nz/x/pipoint"
+	"juju.nz/x/pipoint/analyse"
+)
+
+// exportMain converts event logs into KML and GPX tracks.
+func exportMain(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	kml := fs.String("kml", "", "KML file to write")
+	gpx := fs.String("gpx", "", "GPX file to write")
+	interval := fs.Duration("bearing.interval", 5e9, "Time between camera bearing lines")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 || (*kml == "" && *gpx == "") {
+		log.Fatalln("Usage: pipoint export [-kml out.kml] [-gpx out.gpx] pipoint-*.txt.gz...")
+	}
+
+	events, err := analyse.ParseFiles(fs.Args())
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	track := pipoint.NewTrack(events, *interval)
+	name := strings.TrimSuffix(filepath.Base(fs.Arg(0)), ".txt.gz")
+
+	if *kml != "" {
+		write(*kml, func(f *os.File) error { return track.WriteKML(f, name) })
+	}
+	if *gpx != "" {
+		write(*gpx, func(f *os.File) error { return track.WriteGPX(f, name) })
+	}
+}
+
+// write creates the named file and fills it using fn.
+func write(name string, fn func(f *os.File) error) {
+	f, err := os.Create(name)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := fn(f); err != nil {
+		log.Fatalln(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -17,43 +17,87 @@ package main
 
 import (
 	"flag"
+	"log"
 	"net/http"
+	"os"
 
 	"juju.nz/x/pipoint"
+	"juju.nz/x/pipoint/param"
 
 	"gobot.io/x/gobot"
 	"gobot.io/x/gobot/api"
 	"gobot.io/x/gobot/platforms/mavlink"
-	"gobot.io/x/gobot/platforms/mqtt"
 )
 
 func main() {
 	mqttUrl := flag.String("mqtt.url", "", "URI of the MQTT server, such as tls://iot.juju.net.nz:8883")
+	mqttQoS := flag.Int("mqtt.qos", 0, "QoS of MQTT publishes and subscriptions")
+	mqttJSON := flag.Bool("mqtt.json", false, "Also publish struct params as JSON")
+	mqttHA := flag.String("mqtt.homeassistant", "", "Home Assistant discovery prefix, such as homeassistant")
 	mavAddr := flag.String("mavlink.address", ":14550", "Address to listen on for Mavlink messages")
+	audio := flag.String("audio", "alsa", "Audio backend: alsa, command, or null")
+	audioDevice := flag.String("audio.device", "default", "ALSA device used by the alsa commands")
+	audioPlay := flag.String("audio.play", "aplay -q {file}", "Command used by the command backend to play a WAV file")
+	audioSpeak := flag.String("audio.speak", "espeak {text}", "Command used by the command backend to say text")
+	audioVolume := flag.String("audio.volume", "amixer -q set PCM {percent}%", "Command used by the command backend to set the volume")
 
 	flag.Parse()
 
+	// Client IDs must be unique when running several bases.
+	hostname, _ := os.Hostname()
+	options := &param.MQTTOptions{
+		URL:      *mqttUrl,
+		ClientID: "pipoint-" + hostname,
+		QoS:      byte(*mqttQoS),
+		JSON:     *mqttJSON,
+
+		HomeAssistant: *mqttHA,
+	}
+
+	switch flag.Arg(0) {
+	case "analyse":
+		analyseMain(flag.Args()[1:])
+		return
+	case "export":
+		exportMain(flag.Args()[1:])
+		return
+	case "phrases":
+		phrasesMain(flag.Args()[1:])
+		return
+	case "controller":
+		options.ClientID = "pipoint-controller-" + hostname
+		controllerMain(flag.Args()[1:], options)
+		return
+	}
+
 	var cons []gobot.Connection
 	var drivers []gobot.Device
 
+	backend, err := pipoint.NewAudioBackend(*audio, *audioDevice, *audioPlay, *audioSpeak, *audioVolume)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	pi := pipoint.NewPiPoint()
+	pi.SetAudioBackend(backend)
 
 	if mavAddr != nil && *mavAddr != "" {
 		mav := mavlink.NewUDPAdaptor(*mavAddr)
 		cons = append(cons, mav)
 		driver := mavlink.NewDriver(mav)
 		drivers = append(drivers, driver)
-		driver.On(driver.Event(mavlink.MessageEvent), pi.Message)
+		driver.On(driver.Event(mavlink.PacketEvent), pi.Packet)
 	}
 
 	if mqttUrl != nil && *mqttUrl != "" {
-		mq := mqtt.NewAdaptor(*mqttUrl, "pipoint")
-		cons = append(cons, mq)
-		mq.SetAutoReconnect(true)
-		pi.AddMQTT(mq)
+		if err := pi.AddMQTT(options); err != nil {
+			log.Fatalln(err)
+		}
 	}
 
 	http.HandleFunc("/metrics", pi.Params.Metrics)
+	http.Handle("/params/", http.StripPrefix("/params", http.HandlerFunc(pi.Params.API)))
+	pipoint.NewDashboard(pi, http.DefaultServeMux)
 
 	master := gobot.NewMaster()
 	a := api.NewAPI(master)
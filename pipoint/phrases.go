@@ -0,0 +1,69 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"juju.nz/x/pipoint"
+	"juju.nz/x/pipoint/param"
+)
+
+// phrasesMain lists every phrase and renders any that are missing.
+func phrasesMain(args []string) {
+	fs := flag.NewFlagSet("phrases", flag.ExitOnError)
+	dir := fs.String("dir", pipoint.PhraseDir, "Directory to write the phrases to")
+	tts := fs.String("tts", "espeak -w {file} {text}", "Command that writes {text} to the WAV file {file}")
+	list := fs.Bool("list", false, "Only list the phrases and their files")
+	force := fs.Bool("force", false, "Render all phrases, even if they exist")
+	fs.Parse(args)
+
+	if !*list {
+		if err := os.MkdirAll(*dir, 0755); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	// Include the phrases from the announce rules in the config.
+	var rules map[string]*pipoint.AnnounceRule
+	if err := param.NewParams("pipoint").Unmarshal("announce", &rules); err != nil {
+		log.Fatalf("announce: %v\n", err)
+	}
+
+	failed := 0
+	for _, text := range pipoint.Phrases(rules) {
+		path := pipoint.PhrasePath(*dir, text)
+		if *list {
+			fmt.Printf("%s\t%s\n", path, text)
+			continue
+		}
+		if _, err := os.Stat(path); err == nil && !*force {
+			continue
+		}
+		if err := pipoint.RenderPhrase(*dir, *tts, text); err != nil {
+			log.Println(err)
+			failed++
+			continue
+		}
+		fmt.Println(path)
+	}
+	if failed != 0 {
+		log.Fatalf("%d phrases failed\n", failed)
+	}
+}
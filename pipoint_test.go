@@ -0,0 +1,117 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	common "gobot.io/x/gobot/platforms/mavlink/common"
+)
+
+// newTestPiPoint creates a PiPoint that writes its event log to a
+// temporary directory and reads the given config, if any.
+func newTestPiPoint(t *testing.T, config string) (*PiPoint, func()) {
+	dir, err := ioutil.TempDir("", "pipoint")
+	assert.Nil(t, err)
+	cwd, _ := os.Getwd()
+	os.Chdir(dir)
+	if config != "" {
+		assert.Nil(t, ioutil.WriteFile("pipoint.yml", []byte(config), 0644))
+	}
+
+	pi := NewPiPoint()
+	pi.SetAudioBackend(NullBackend{})
+	return pi, func() {
+		os.Chdir(cwd)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestPiPointMetrics(t *testing.T) {
+	pi, done := newTestPiPoint(t, "")
+	defer done()
+
+	pi.Message(&common.Heartbeat{})
+	pi.Message(&common.SysStatus{VOLTAGE_BATTERY: 12000, BATTERY_REMAINING: 50})
+	pi.ticked()
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(pi.Params)
+	families, err := registry.Gather()
+	assert.Nil(t, err)
+
+	names := make(map[string]bool)
+	for _, family := range families {
+		names[family.GetName()] = true
+	}
+	assert.True(t, names["pipoint_rover_heartbeats"])
+	assert.True(t, names["pipoint_seconds"])
+	assert.True(t, names["pipoint_tick"])
+	assert.True(t, names["pipoint_rover_battery_voltage"])
+}
+
+func TestPiPointAnnounceConfig(t *testing.T) {
+	// Every rule in the example config watches a real param or leaf.
+	config := viper.New()
+	config.SetConfigFile("etc/pipoint.yml")
+	assert.Nil(t, config.ReadInConfig())
+	var rules map[string]*AnnounceRule
+	assert.Nil(t, config.UnmarshalKey("pipoint.announce", &rules))
+	assert.NotEmpty(t, rules)
+
+	pi, done := newTestPiPoint(t, "")
+	defer done()
+	assert.Nil(t, pi.announcer.Configure(rules))
+}
+
+func TestLocateKeepsSavedBase(t *testing.T) {
+	gps := &common.GpsRawInt{LAT: -473000000, LON: 1700000000, ALT: 20000}
+
+	// Without a saved base, the base follows the rover.
+	pi, done := newTestPiPoint(t, "")
+	pi.Message(gps)
+	pi.getState().Update(pi.neu.Param)
+	base, ok := pi.base.Value()
+	assert.True(t, ok)
+	assert.True(t, pi.base.Ok())
+	assert.InDelta(t, 20, base.Up, 0.001)
+	done()
+
+	pi, done = newTestPiPoint(t, `
+pipoint:
+  base:
+    position:
+      north: 1000
+      east: 2000
+      up: 5
+`)
+	defer done()
+	assert.Equal(t, "Locate", pi.getState().Name())
+	pi.Message(gps)
+	pi.getState().Update(pi.neu.Param)
+
+	rover, _ := pi.rover.Value()
+	assert.InDelta(t, 20, rover.Up, 0.001)
+	base, _ = pi.base.Value()
+	assert.Equal(t, &NEUPosition{North: 1000, East: 2000, Up: 5}, base)
+	assert.True(t, pi.base.Ok())
+}
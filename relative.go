@@ -0,0 +1,98 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"math"
+
+	"juju.nz/x/pipoint/param"
+)
+
+// relativeMeta describes a Relative param.
+var relativeMeta = &param.Meta{
+	ReadOnly: true,
+	MaxAge:   gpsMaxAge,
+	Leaves: map[string]*param.Meta{
+		"time":     {Unit: "s"},
+		"range":    {Description: "Straight line distance to the rover", Unit: "m"},
+		"distance": {Description: "Ground distance to the rover", Unit: "m"},
+		"height":   {Description: "Rover height above the base", Unit: "m"},
+		"bearing":  {Description: "Bearing to the rover", Unit: "deg"},
+		"closing":  {Description: "Speed the rover is approaching at", Unit: "m/s"},
+	},
+}
+
+// lensMeta describes a Lens param.
+var lensMeta = &param.Meta{
+	Leaves: map[string]*param.Meta{
+		"range":   {Description: "Distance that needs no zoom", Unit: "m", Min: 1, Max: 10000},
+		"maxzoom": {Description: "Highest zoom of the camera", Min: 1, Max: 100},
+	},
+}
+
+// relative returns the rover position relative to the base.  The
+// closing speed is found from last, which may be nil.
+func relative(rover, base, offset *NEUPosition, last *Relative) *Relative {
+	delta := rover.Sub(base.Add(offset))
+
+	distance := math.Hypot(delta.North, delta.East)
+	bearing := AsDeg(math.Atan2(delta.East, delta.North))
+	if bearing < 0 {
+		bearing += 360
+	}
+
+	r := &Relative{
+		Time:     rover.Time,
+		Range:    math.Hypot(distance, delta.Up),
+		Distance: distance,
+		Height:   delta.Up,
+		Bearing:  bearing,
+	}
+	if last != nil {
+		if dt := r.Time - last.Time; dt > 0 {
+			r.Closing = (last.Range - r.Range) / dt
+		}
+	}
+	return r
+}
+
+// zoom returns the zoom that keeps the rover the same size as at
+// lens.Range, limited to the range of the lens.
+func zoom(lens *Lens, distance float64) float64 {
+	if lens.Range <= 0 || lens.MaxZoom <= 1 {
+		return 1
+	}
+	return math.Max(1, math.Min(lens.MaxZoom, distance/lens.Range))
+}
+
+// updateRelative recalculates the rover position relative to the base
+// and the zoom hint.
+func (pi *PiPoint) updateRelative() {
+	rover, ok1 := pi.neu.Value()
+	base, ok2 := pi.base.Value()
+	offset, ok3 := pi.baseOffset.Value()
+	if !ok1 || !ok2 || !ok3 || !pi.base.Ok() {
+		return
+	}
+
+	last, _ := pi.relative.Value()
+	r := relative(rover, base, offset, last)
+	pi.relative.Set(r)
+
+	if lens, ok := pi.lens.Value(); ok {
+		pi.zoom.SetFloat64(zoom(lens, r.Range))
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelative(t *testing.T) {
+	base := &NEUPosition{North: 2000, East: 3000, Up: 10}
+	offset := &NEUPosition{Up: 2}
+
+	rover := &NEUPosition{Time: 10, North: 2000, East: 2700, Up: 412}
+	r := relative(rover, base, offset, nil)
+	assert.InDelta(t, 10, r.Time, 0.001)
+	assert.InDelta(t, 300, r.Distance, 0.001)
+	assert.InDelta(t, 400, r.Height, 0.001)
+	assert.InDelta(t, 500, r.Range, 0.001)
+	assert.InDelta(t, 270, r.Bearing, 0.001)
+	assert.InDelta(t, 0, r.Closing, 0.001)
+
+	// 450 m closer after 2 s.
+	rover = &NEUPosition{Time: 12, North: 2040, East: 3000, Up: 42}
+	r = relative(rover, base, offset, r)
+	assert.InDelta(t, 40, r.Distance, 0.001)
+	assert.InDelta(t, 50, r.Range, 0.001)
+	assert.InDelta(t, 0, r.Bearing, 0.001)
+	assert.InDelta(t, 225, r.Closing, 0.001)
+}
+
+func TestZoom(t *testing.T) {
+	// Disabled.
+	assert.Equal(t, 1.0, zoom(&Lens{Range: 50, MaxZoom: 1}, 500))
+
+	lens := &Lens{Range: 50, MaxZoom: 4}
+	assert.Equal(t, 1.0, zoom(lens, 10))
+	assert.Equal(t, 2.0, zoom(lens, 100))
+	assert.Equal(t, 4.0, zoom(lens, 1000))
+}
+
+func TestAnnounceRelative(t *testing.T) {
+	a, audio, ps := newTestAnnouncer()
+	rel := ps.NewWith("rover.relative", &Relative{}, relativeMeta)
+
+	a.Configure(map[string]*AnnounceRule{
+		"distance": {
+			Param: "rover.relative.distance",
+			When:  "update",
+			Min:   20,
+			Max:   10000,
+			Say:   `{{printf "%.0f" (round .Value 50)}} metres, {{printf "%.0f" (round (param "rover.relative.height") 10)}} up`,
+		},
+	})
+
+	rel.Set(&Relative{Distance: 10, Height: 5})
+	a.Update(rel, "Run")
+	rel.Set(&Relative{Distance: 190, Height: 52})
+	a.Update(rel, "Run")
+	assert.Equal(t, []string{"200 metres, 50 up"}, drain(audio))
+}
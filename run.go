@@ -36,20 +36,13 @@ func (s *RunState) Name() string {
 // Update is called when a param is updated.
 func (s *RunState) Update(param *param.Param) {
 	switch param {
-	case s.pi.neu:
+	case s.pi.neu.Param:
 		s.pi.rover.Set(param.Get())
-	case s.pi.seconds:
-		if (param.GetInt()%5) == 0 && s.pi.vel.Ok() {
-			kph := s.pi.vel.GetFloat64() * 3.6
-			if kph >= 2 {
-				s.pi.audio.Say(fmt.Sprintf("%.0f kph", kph))
-			}
-		}
 	case s.pi.mark:
 		s.pi.state.Inc()
 	}
 
-	if param != s.pi.rover {
+	if param != s.pi.rover.Param {
 		return
 	}
 
@@ -57,9 +50,13 @@ func (s *RunState) Update(param *param.Param) {
 		return
 	}
 
-	rover := s.pi.rover.Get().(*NEUPosition)
-	base := s.pi.base.Get().(*NEUPosition)
-	baseOffset := s.pi.baseOffset.Get().(*NEUPosition)
+	rover, ok1 := s.pi.rover.Value()
+	base, ok2 := s.pi.base.Value()
+	baseOffset, ok3 := s.pi.baseOffset.Value()
+	offset, ok4 := s.pi.offset.Value()
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return
+	}
 
 	att, err := point(rover, base, baseOffset)
 	if err != nil {
@@ -67,7 +64,6 @@ func (s *RunState) Update(param *param.Param) {
 		return
 	}
 
-	offset := s.pi.offset.Get().(*Attitude)
 	s.pi.pan.Set(util.WrapAngle(att.Yaw + offset.Yaw))
 	s.pi.tilt.Set(util.WrapAngle(att.Pitch + offset.Pitch))
 }
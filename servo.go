@@ -35,10 +35,31 @@ type ServoParams struct {
 	Tau float64
 }
 
+// servoHistory is the number of demand and output values to record,
+// which is a minute at 50 Hz.
+const servoHistory = 3000
+
+// servoLimit is the metadata for a pulse width limit.
+var servoLimit = &param.Meta{Unit: "ms", Min: 0.4, Max: 2.6}
+
+// servoMeta describes the ServoParams leaves.
+var servoMeta = &param.Meta{
+	Description: "Servo pin, span, and limits",
+	Leaves: map[string]*param.Meta{
+		"pin":  {Description: "ServoBlaster pin or -1 for none", Min: -1, Max: 7},
+		"span": {Description: "Angle covered from Low to High", Unit: "rad", Min: 0, Max: 2 * math.Pi},
+		"min":  servoLimit,
+		"max":  servoLimit,
+		"low":  servoLimit,
+		"high": servoLimit,
+		"tau":  {Description: "Low pass filter time constant", Unit: "s", Min: 0, Max: 10},
+	},
+}
+
 // Servo is a servo on a pin with limits, demand, and actual
 // position.
 type Servo struct {
-	params *param.Param
+	params ServoParamsParam
 	sp     *param.Param
 	pv     *param.Param
 	pwm    *ServoBlaster
@@ -48,7 +69,7 @@ type Servo struct {
 // NewServo creates a new servo with params on the given tree.
 func NewServo(name string, params *param.Params) *Servo {
 	s := &Servo{
-		params: params.NewWith(name, &ServoParams{
+		params: ServoParamsParam{params.NewWith(name, &ServoParams{
 			Pin:  -1,
 			Min:  1.0,
 			Max:  2.0,
@@ -56,11 +77,21 @@ func NewServo(name string, params *param.Params) *Servo {
 			High: 1.9,
 			Span: math.Pi,
 			Tau:  1.0,
+		}, servoMeta)},
+		sp: params.NewNum(name+".sp", &param.Meta{
+			Description: "Demanded angle",
+			Unit:        "rad",
+			History:     servoHistory,
+		}),
+		pv: params.NewNum(name+".pv", &param.Meta{
+			Description: "Output pulse width",
+			Unit:        "ms",
+			ReadOnly:    true,
+			History:     servoHistory,
 		}),
-		sp:     params.NewNum(name + ".sp"),
-		pv:     params.NewNum(name + ".pv"),
 		filter: &Lowpass{},
 	}
+	s.params.Persist()
 
 	return s
 }
@@ -73,7 +104,10 @@ func (s *Servo) Set(angle float64) {
 
 // Tick updates the servo output based on demand.  Call every ~20 ms.
 func (s *Servo) Tick() {
-	params := s.params.Get().(*ServoParams)
+	params, ok := s.params.Value()
+	if !ok {
+		return
+	}
 
 	angle := s.sp.GetFloat64()
 	angle = s.filter.StepEx(angle, params.Tau)
@@ -0,0 +1,103 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"math"
+	"strings"
+
+	common "gobot.io/x/gobot/platforms/mavlink/common"
+)
+
+// sensor is one of the MAV_SYS_STATUS_SENSOR bits.
+type sensor struct {
+	// key names the sensor in the rover.sensors param.
+	key string
+	// spoken is the name used in announcements.
+	spoken string
+}
+
+// sensors are the MAV_SYS_STATUS_SENSOR bits in bit order.
+var sensors = []sensor{
+	{"gyro", "Gyro"},
+	{"accel", "Accelerometer"},
+	{"mag", "Compass"},
+	{"baro", "Barometer"},
+	{"airspeed", "Airspeed"},
+	{"gps", "GPS"},
+	{"flow", "Optical flow"},
+	{"vision", "Vision"},
+	{"laser", "Laser"},
+	{"truth", "Ground truth"},
+	{"rate", "Rate control"},
+	{"attitude", "Attitude control"},
+	{"yaw", "Yaw control"},
+	{"altitude", "Altitude control"},
+	{"position", "Position control"},
+	{"motors", "Motors"},
+	{"rc", "RC receiver"},
+	{"gyro2", "Gyro 2"},
+	{"accel2", "Accelerometer 2"},
+	{"mag2", "Compass 2"},
+	{"geofence", "Geofence"},
+	{"ahrs", "AHRS"},
+	{"terrain", "Terrain"},
+	{"reverse", "Reverse motor"},
+	{"logging", "Logging"},
+	{"battery", "Battery"},
+}
+
+// sensorHealth returns whether each enabled sensor is healthy.
+func sensorHealth(status *common.SysStatus) map[string]bool {
+	health := make(map[string]bool)
+	for i, s := range sensors {
+		bit := uint32(1) << uint(i)
+		if status.ONBOARD_CONTROL_SENSORS_PRESENT&status.ONBOARD_CONTROL_SENSORS_ENABLED&bit != 0 {
+			health[s.key] = status.ONBOARD_CONTROL_SENSORS_HEALTH&bit != 0
+		}
+	}
+	return health
+}
+
+// failedSensors returns the spoken names of the unhealthy sensors in
+// bit order, or "" if all are healthy.
+func failedSensors(health map[string]bool) string {
+	var failed []string
+	for _, s := range sensors {
+		if ok, enabled := health[s.key]; enabled && !ok {
+			failed = append(failed, s.spoken)
+		}
+	}
+	return strings.Join(failed, " and ")
+}
+
+// updateSysStatus decodes the battery and sensor health.  Values
+// that the rover doesn't know are skipped.
+func (pi *PiPoint) updateSysStatus(status *common.SysStatus) {
+	if status.VOLTAGE_BATTERY != math.MaxUint16 {
+		pi.batteryVoltage.SetFloat64(float64(status.VOLTAGE_BATTERY) * 1e-3)
+	}
+	if status.CURRENT_BATTERY != -1 {
+		pi.batteryCurrent.SetFloat64(float64(status.CURRENT_BATTERY) * 1e-2)
+	}
+	if status.BATTERY_REMAINING >= 0 {
+		pi.batteryRemaining.SetInt(int(status.BATTERY_REMAINING))
+	}
+
+	health := sensorHealth(status)
+	pi.sensors.Set(health)
+	pi.failed.Set(failedSensors(health))
+}
@@ -0,0 +1,63 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	common "gobot.io/x/gobot/platforms/mavlink/common"
+)
+
+func TestSensorHealth(t *testing.T) {
+	status := &common.SysStatus{
+		// Gyro, accel, mag, and GPS are present.
+		ONBOARD_CONTROL_SENSORS_PRESENT: 0x27,
+		// Mag isn't enabled.
+		ONBOARD_CONTROL_SENSORS_ENABLED: 0x23,
+		// Accel and GPS are unhealthy.
+		ONBOARD_CONTROL_SENSORS_HEALTH: 0x05,
+	}
+
+	health := sensorHealth(status)
+	assert.Equal(t, map[string]bool{"gyro": true, "accel": false, "gps": false}, health)
+	assert.Equal(t, "Accelerometer and GPS", failedSensors(health))
+
+	status.ONBOARD_CONTROL_SENSORS_HEALTH = 0xffffffff
+	assert.Equal(t, "", failedSensors(sensorHealth(status)))
+}
+
+func TestAnnounceSysStatus(t *testing.T) {
+	a, audio, ps := newTestAnnouncer()
+	remaining := ps.NewNum("rover.battery.remaining")
+	failed := ps.NewWith("rover.failed", "")
+
+	for _, percent := range []int{80, 40, 19, 18, 17} {
+		remaining.SetInt(percent)
+		a.Update(remaining, "Run")
+	}
+	assert.Equal(t, []string{"Battery 19 percent"}, drain(audio))
+	assert.Contains(t, Phrases(nil), "Battery 19 percent")
+
+	for _, text := range []string{"", "", "GPS", "GPS", ""} {
+		failed.Set(text)
+		a.Update(failed, "Run")
+	}
+	assert.Equal(t, []string{"GPS failed"}, drain(audio))
+	assert.Contains(t, Phrases(nil), "GPS failed")
+	assert.Equal(t, "GPS failed", a.said.Get())
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"math"
+	"time"
+
+	"juju.nz/x/pipoint/analyse"
+)
+
+// TrackPoint is a position at a local time.
+type TrackPoint struct {
+	Stamp time.Time
+	Position
+}
+
+// Bearing is the direction the camera was pointing at a local time.
+type Bearing struct {
+	Stamp time.Time
+	// Yaw is the bearing from true north in radians.
+	Yaw float64
+	// Range is the distance to the rover in m.
+	Range float64
+}
+
+// StateChange is when the system entered a new state.
+type StateChange struct {
+	Stamp time.Time
+	Name  string
+	// At is the rover position at the time, if known.
+	At *Position
+}
+
+// Track is a recorded session.
+type Track struct {
+	Rover    []*TrackPoint
+	Base     *Position
+	Bearings []*Bearing
+	States   []*StateChange
+}
+
+// position converts the leaves of a Position event.
+func position(values map[string]float64) *Position {
+	return &Position{
+		Time:    values["time"],
+		Lat:     values["lat"],
+		Lon:     values["lon"],
+		Alt:     values["alt"],
+		Heading: values["heading"],
+	}
+}
+
+// neuPosition converts the leaves of a NEUPosition event.
+func neuPosition(values map[string]float64) *NEUPosition {
+	return &NEUPosition{
+		Time:  values["time"],
+		North: values["north"],
+		East:  values["east"],
+		Up:    values["up"],
+	}
+}
+
+// NewTrack builds a track from event log events, adding a camera
+// bearing at most every interval.
+func NewTrack(events []*analyse.Event, interval time.Duration) *Track {
+	t := &Track{}
+	offset := 0.0
+	var last time.Time
+
+	for _, e := range events {
+		switch e.Name {
+		case "gps":
+			if e.Values["lat"] == 0 && e.Values["lon"] == 0 {
+				// No fix yet.
+				continue
+			}
+			t.Rover = append(t.Rover, &TrackPoint{e.Time, *position(e.Values)})
+		case "base.position":
+			t.Base = neuPosition(e.Values).ToPosition()
+		case "pantilt.offset":
+			offset = e.Values["yaw"]
+		case "pantilt.pan.sp":
+			if e.Time.Sub(last) < interval || t.Base == nil || len(t.Rover) == 0 {
+				continue
+			}
+			last = e.Time
+			t.Bearings = append(t.Bearings, &Bearing{
+				Stamp: e.Time,
+				Yaw:   e.Values[""] - offset,
+				Range: distance(t.Base, &t.Rover[len(t.Rover)-1].Position),
+			})
+		case "state":
+			change := &StateChange{
+				Stamp: e.Time,
+				Name:  stateName(int(e.Values[""])),
+			}
+			if len(t.Rover) != 0 {
+				change.At = &t.Rover[len(t.Rover)-1].Position
+			}
+			t.States = append(t.States, change)
+		}
+	}
+	return t
+}
+
+// distance returns the horizontal distance in m between two
+// positions.
+func distance(from, to *Position) float64 {
+	lat := AsRad((from.Lat + to.Lat) / 2)
+	north := (to.Lat - from.Lat) * LatLength(lat)
+	east := (to.Lon - from.Lon) * LonLength(lat)
+	return math.Hypot(north, east)
+}
+
+// project returns the position dist m from p along the given bearing
+// in radians.
+func project(p *Position, bearing, dist float64) *Position {
+	lat := AsRad(p.Lat)
+	return &Position{
+		Lat: p.Lat + dist*math.Cos(bearing)/LatLength(lat),
+		Lon: p.Lon + dist*math.Sin(bearing)/LonLength(lat),
+		Alt: p.Alt,
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"juju.nz/x/pipoint/param"
+)
+
+// AttitudeParam is a param that holds an *Attitude.
+type AttitudeParam struct {
+	*param.Param
+}
+
+// Value returns the attitude, and false if the param is unset or
+// holds a different type.
+func (p AttitudeParam) Value() (*Attitude, bool) {
+	v, ok := p.Get().(*Attitude)
+	return v, ok && v != nil
+}
+
+// NEUPositionParam is a param that holds a *NEUPosition.
+type NEUPositionParam struct {
+	*param.Param
+}
+
+// Value returns the position, and false if the param is unset or
+// holds a different type.
+func (p NEUPositionParam) Value() (*NEUPosition, bool) {
+	v, ok := p.Get().(*NEUPosition)
+	return v, ok && v != nil
+}
+
+// PositionParam is a param that holds a *Position.
+type PositionParam struct {
+	*param.Param
+}
+
+// Value returns the position, and false if the param is unset or
+// holds a different type.
+func (p PositionParam) Value() (*Position, bool) {
+	v, ok := p.Get().(*Position)
+	return v, ok && v != nil
+}
+
+// ServoParamsParam is a param that holds *ServoParams.
+type ServoParamsParam struct {
+	*param.Param
+}
+
+// Value returns the servo params, and false if the param is unset or
+// holds a different type.
+func (p ServoParamsParam) Value() (*ServoParams, bool) {
+	v, ok := p.Get().(*ServoParams)
+	return v, ok && v != nil
+}
+
+// RelativeParam is a param that holds a *Relative.
+type RelativeParam struct {
+	*param.Param
+}
+
+// Value returns the relative position, and false if the param is
+// unset or holds a different type.
+func (p RelativeParam) Value() (*Relative, bool) {
+	v, ok := p.Get().(*Relative)
+	return v, ok && v != nil
+}
+
+// LensParam is a param that holds a *Lens.
+type LensParam struct {
+	*param.Param
+}
+
+// Value returns the lens, and false if the param is unset or holds a
+// different type.
+func (p LensParam) Value() (*Lens, bool) {
+	v, ok := p.Get().(*Lens)
+	return v, ok && v != nil
+}
+
+// EventLoggerParamsParam is a param that holds a *EventLoggerParams.
+type EventLoggerParamsParam struct {
+	*param.Param
+}
+
+// Value returns the event logger params, and false if the param is
+// unset or holds a different type.
+func (p EventLoggerParamsParam) Value() (*EventLoggerParams, bool) {
+	v, ok := p.Get().(*EventLoggerParams)
+	return v, ok && v != nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pipoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"juju.nz/x/pipoint/param"
+)
+
+func TestTypedParams(t *testing.T) {
+	ps := &param.Params{Name: "root"}
+	rover := NEUPositionParam{ps.New("rover")}
+
+	_, ok := rover.Value()
+	assert.False(t, ok)
+
+	rover.Set(&NEUPosition{North: 1})
+	pos, ok := rover.Value()
+	assert.True(t, ok)
+	assert.Equal(t, pos.North, 1.0)
+
+	// Set to the wrong type, such as over MQTT before the first
+	// update.
+	gps := PositionParam{ps.New("gps")}
+	gps.Set("texty")
+	_, ok = gps.Value()
+	assert.False(t, ok)
+
+	var nilAttitude *Attitude
+	offset := AttitudeParam{ps.NewWith("offset", nilAttitude)}
+	_, ok = offset.Value()
+	assert.False(t, ok)
+}
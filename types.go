@@ -40,6 +40,31 @@ type Attitude struct {
 	Yaw   float64
 }
 
+// Relative is the position and motion of the rover relative to the
+// base.
+type Relative struct {
+	// Time is the time of the rover position in seconds.
+	Time float64
+	// Range is the straight line distance in metres.
+	Range float64
+	// Distance is the distance along the ground in metres.
+	Distance float64
+	// Height is the height above the base in metres.
+	Height float64
+	// Bearing is the direction in degrees clockwise from north.
+	Bearing float64
+	// Closing is the rate that the range is shrinking in m/s.
+	Closing float64
+}
+
+// Lens describes the camera zoom.
+type Lens struct {
+	// Range is the distance in metres that needs no zoom.
+	Range float64
+	// MaxZoom is the highest zoom the camera supports.
+	MaxZoom float64
+}
+
 // ToNEU converts a geographic position to local tangent plane.
 func (p *Position) ToNEU() *NEUPosition {
 	lat := AsRad(p.Lat)
@@ -52,6 +77,23 @@ func (p *Position) ToNEU() *NEUPosition {
 	}
 }
 
+// ToPosition converts a local tangent plane position back to
+// geographic coordinates.  Inverse of ToNEU.
+func (p *NEUPosition) ToPosition() *Position {
+	// The scale depends on the latitude, so iterate towards it.
+	lat := p.North / m1
+	for i := 0; i < 5; i++ {
+		lat = p.North / LatLength(AsRad(lat))
+	}
+
+	return &Position{
+		Time: p.Time,
+		Lat:  lat,
+		Lon:  p.East / LonLength(AsRad(lat)),
+		Alt:  p.Up,
+	}
+}
+
 // Sub returns piecewise this minus right.
 func (p *NEUPosition) Sub(right *NEUPosition) *NEUPosition {
 	return &NEUPosition{